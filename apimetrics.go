@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	apiCallDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "update_route53_api_call_duration_seconds",
+		Help: "Latency of AWS API call attempts, by service and operation",
+	}, []string{"service", "operation"})
+	apiCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "update_route53_api_calls_total",
+		Help: "AWS API call attempts, by service, operation and result",
+	}, []string{"service", "operation", "result"})
+	apiThrottled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "update_route53_api_throttled_total",
+		Help: "AWS API call attempts rejected by throttling, by service and operation",
+	}, []string{"service", "operation"})
+)
+
+func init() {
+	prometheus.MustRegister(apiCallDuration)
+	prometheus.MustRegister(apiCalls)
+	prometheus.MustRegister(apiThrottled)
+}
+
+// instrumentAPICalls adds a middleware measuring AWS API calls to the stack
+// of every operation. It runs after the retryer, so each attempt of a
+// retried call is measured.
+func instrumentAPICalls(stack *middleware.Stack) error {
+	mw := middleware.FinalizeMiddlewareFunc("APIMetrics", func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+		start := time.Now()
+		out, metadata, err := next.HandleFinalize(ctx, in)
+		observeAPICall(awsmiddleware.GetServiceID(ctx), awsmiddleware.GetOperationName(ctx), time.Since(start), err)
+		return out, metadata, err
+	})
+	if _, ok := stack.Finalize.Get("Retry"); ok {
+		return stack.Finalize.Insert(mw, "Retry", middleware.After)
+	}
+	return stack.Finalize.Add(mw, middleware.After)
+}
+
+// observeAPICall records the outcome of an attempt of an AWS API call in the
+// metrics.
+func observeAPICall(service, operation string, latency time.Duration, err error) {
+	result := "success"
+	switch {
+	case errors.Is(classifyError(err), errThrottled):
+		result = "throttled"
+		apiThrottled.WithLabelValues(service, operation).Inc()
+	case err != nil:
+		result = "error"
+	}
+	apiCallDuration.WithLabelValues(service, operation).Observe(latency.Seconds())
+	apiCalls.WithLabelValues(service, operation, result).Inc()
+
+	if service == route53.ServiceID {
+		countRoute53Call()
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"flouret.io/update-route53/pkg/provider"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// auditEntry is a change of a record set submitted to Route53, as written to
+// the audit log.
+type auditEntry struct {
+	Timestamp     time.Time `json:"timestamp"`
+	Action        string    `json:"action"`
+	Record        string    `json:"record"`
+	Type          string    `json:"type"`
+	SetIdentifier string    `json:"setIdentifier,omitempty"`
+	HostedZoneId  string    `json:"hostedZoneId"`
+	OldValues     []string  `json:"oldValues"`
+	NewValues     []string  `json:"newValues"`
+	TTL           int64     `json:"ttl,omitempty"`
+	ChangeId      string    `json:"changeId"`
+	Cycle         string    `json:"cycle,omitempty"`
+	Caller        string    `json:"caller,omitempty"` // ARN of the AWS identity
+	Host          string    `json:"host"`
+}
+
+// auditLog is the append-only file changes are written to, one JSON object
+// per line, if AUDIT_LOG is set.
+var auditLog *os.File
+
+var (
+	auditMu     sync.Mutex
+	auditCaller string // ARN of the AWS identity submitting changes
+	auditHost   string // Host name of this instance
+)
+
+// openAuditLog opens the audit log for appending, creating it if needed, and
+// resolves the AWS identity recorded with each change.
+func openAuditLog(svc *sts.Client) error {
+	if err := reopenAuditLog(); err != nil {
+		return err
+	}
+	auditHost, _ = os.Hostname()
+
+	identity, err := svc.GetCallerIdentity(context.TODO(), &sts.GetCallerIdentityInput{})
+	if err != nil {
+		logger.Err(err).Msg("unable to get aws caller identity for the audit log")
+		return nil
+	}
+	auditCaller = aws.ToString(identity.Arn)
+	return nil
+}
+
+// reopenAuditLog opens the audit log again if the file was replaced, by
+// pruning or log rotation, since it was opened.
+func reopenAuditLog() error {
+	if auditLog != nil {
+		current, err1 := os.Stat(auditLogPath)
+		opened, err2 := auditLog.Stat()
+		if err1 == nil && err2 == nil && os.SameFile(current, opened) {
+			return nil
+		}
+		auditLog.Close()
+	}
+	f, err := os.OpenFile(auditLogPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		auditLog = nil
+		return err
+	}
+	auditLog = f
+	return nil
+}
+
+// pruneAuditLog removes the entries older than AUDIT_LOG_MAX_AGE, then the
+// oldest entries beyond AUDIT_LOG_MAX_ENTRIES, from the audit log. The file
+// is replaced atomically. It returns the number of entries kept and pruned.
+func pruneAuditLog() (kept, pruned int, err error) {
+	data, err := os.ReadFile(auditLogPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var lines [][]byte
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		// Entries that cannot be parsed are kept, so nothing is lost by
+		// mistake
+		var entry struct {
+			Timestamp time.Time `json:"timestamp"`
+		}
+		if auditMaxAge > 0 && json.Unmarshal(line, &entry) == nil && time.Since(entry.Timestamp) > auditMaxAge {
+			pruned++
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if auditMaxEntries > 0 && len(lines) > auditMaxEntries {
+		pruned += len(lines) - auditMaxEntries
+		lines = lines[len(lines)-auditMaxEntries:]
+	}
+	if pruned == 0 {
+		return len(lines), 0, nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(auditLogPath), filepath.Base(auditLogPath)+".*")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer os.Remove(tmp.Name())
+	if info, err := os.Stat(auditLogPath); err == nil {
+		tmp.Chmod(info.Mode().Perm())
+	}
+	if _, err := tmp.Write(bytes.Join(lines, nil)); err != nil {
+		tmp.Close()
+		return 0, 0, err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return 0, 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, 0, err
+	}
+	if err := os.Rename(tmp.Name(), auditLogPath); err != nil {
+		return 0, 0, err
+	}
+	return len(lines), pruned, nil
+}
+
+// auditRetention reports whether old entries of the audit log are pruned.
+func auditRetention() bool {
+	return auditMaxAge > 0 || auditMaxEntries > 0
+}
+
+// auditKey identifies a record set in the old values passed to auditChanges.
+func auditKey(name string, rrType types.RRType, setIdentifier string) string {
+	return fmt.Sprintf("%s/%s/%s", strings.ToLower(strings.TrimSuffix(name, ".")), rrType, setIdentifier)
+}
+
+// auditChanges writes the changes submitted to a hosted zone to the audit log,
+// if enabled. old holds the values of the record sets before the change, by
+// auditKey, when they are known. Failures are logged, as the changes are
+// already submitted.
+func auditChanges(zone, changeId string, changes []types.Change, old map[string][]string) {
+	if auditLogPath == "" {
+		return
+	}
+
+	var data []byte
+	now := time.Now().UTC()
+	for _, change := range changes {
+		rs := change.ResourceRecordSet
+		values := provider.Values(rs)
+		if rs.AliasTarget != nil {
+			values = []string{"alias:" + aws.ToString(rs.AliasTarget.DNSName)}
+		}
+		entry := auditEntry{
+			Timestamp:     now,
+			Action:        string(change.Action),
+			Record:        strings.TrimSuffix(provider.DisplayName(aws.ToString(rs.Name)), "."),
+			Type:          string(rs.Type),
+			SetIdentifier: aws.ToString(rs.SetIdentifier),
+			HostedZoneId:  zone,
+			OldValues:     old[auditKey(aws.ToString(rs.Name), rs.Type, aws.ToString(rs.SetIdentifier))],
+			NewValues:     values,
+			TTL:           aws.ToInt64(rs.TTL),
+			ChangeId:      changeId,
+			Cycle:         currentCycle(),
+			Caller:        auditCaller,
+			Host:          auditHost,
+		}
+		if change.Action == types.ChangeActionDelete {
+			// Deletions hold the exact values of the record set
+			entry.OldValues, entry.NewValues = values, nil
+		}
+		line, err := json.Marshal(entry)
+		if err != nil {
+			logger.Err(err).Msg("unable to encode audit entry")
+			continue
+		}
+		data = append(append(data, line...), '\n')
+	}
+
+	// A single write per batch keeps the lines of concurrent writers intact
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	if err := reopenAuditLog(); err != nil {
+		logger.Err(err).Str("changeId", changeId).Msg("unable to open audit log")
+		return
+	}
+	if _, err := auditLog.Write(data); err != nil {
+		logger.Err(err).Str("changeId", changeId).Msg("unable to write audit log")
+		return
+	}
+	if err := auditLog.Sync(); err != nil {
+		logger.Err(err).Str("changeId", changeId).Msg("unable to sync audit log")
+	}
+
+	if auditRetention() {
+		if _, _, err := pruneAuditLog(); err != nil {
+			logger.Err(err).Msg("unable to prune audit log")
+		}
+	}
+}
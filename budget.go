@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// apiBudget counts the Route53 API calls of the current UTC day, against
+// ROUTE53_DAILY_BUDGET.
+var apiBudget struct {
+	mu       sync.Mutex
+	day      string // UTC day of the count
+	calls    int    // Route53 API call attempts of the day
+	exceeded bool   // Whether the budget was reported exceeded on that day
+}
+
+// rollBudget starts a new count when the UTC day changes. apiBudget.mu must
+// be held.
+func rollBudget() {
+	if day := time.Now().UTC().Format(time.DateOnly); day != apiBudget.day {
+		apiBudget.day, apiBudget.calls, apiBudget.exceeded = day, 0, false
+	}
+}
+
+// countRoute53Call counts an attempt of a Route53 API call against the
+// budget.
+func countRoute53Call() {
+	apiBudget.mu.Lock()
+	defer apiBudget.mu.Unlock()
+	rollBudget()
+	apiBudget.calls++
+}
+
+// overBudget reports whether the Route53 API calls of the day reached
+// ROUTE53_DAILY_BUDGET, in which case the records are not read, relying on
+// their cached values, and only changes are submitted. The first time the
+// budget is exceeded on a day, it is logged and notified.
+func overBudget() bool {
+	if route53DailyBudget == 0 {
+		return false
+	}
+	apiBudget.mu.Lock()
+	rollBudget()
+	over := apiBudget.calls >= route53DailyBudget
+	report := over && !apiBudget.exceeded
+	if over {
+		apiBudget.exceeded = true
+	}
+	calls := apiBudget.calls
+	apiBudget.mu.Unlock()
+
+	if report {
+		logger.Warn().
+			Int("calls", calls).
+			Int("budget", route53DailyBudget).
+			Msg("daily route53 api budget exceeded, using cached record values until tomorrow (UTC)")
+		notify(event{
+			Type:      eventBudget,
+			Error:     fmt.Sprintf("%d Route53 API calls today, over the budget of %d: records are not read until tomorrow (UTC)", calls, route53DailyBudget),
+			Timestamp: time.Now().UTC(),
+		})
+	}
+	return over
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+)
+
+// Limits of PutLogEvents, and of the events kept while CloudWatch Logs is
+// unreachable
+const (
+	cloudWatchMaxBatchEvents = 10000
+	cloudWatchMaxBatchBytes  = 1048576
+	cloudWatchEventOverhead  = 26 // Bytes counted for each event
+	cloudWatchMaxBuffered    = 50000
+)
+
+// cloudWatchWriter ships log events to a CloudWatch Logs stream. Events are
+// buffered and sent in batches every flush interval. Failed batches are
+// retried on the next flush, dropping the oldest events if too many pile up.
+type cloudWatchWriter struct {
+	svc    *cloudwatchlogs.Client
+	group  string
+	stream string
+
+	mu     sync.Mutex
+	events []types.InputLogEvent // Buffered events, guarded by mu
+
+	// Guarded by flushMu
+	flushMu sync.Mutex
+	unsent  []types.InputLogEvent // Events of the current flush not sent yet
+	created bool                  // Whether the log stream was created
+}
+
+// cloudWatchLogs ships logs to CloudWatch Logs, if CLOUDWATCH_LOG_GROUP is
+// set.
+var cloudWatchLogs *cloudWatchWriter
+
+// newCloudWatchWriter returns a writer for the given log group and stream,
+// and starts flushing it at the given interval.
+func newCloudWatchWriter(svc *cloudwatchlogs.Client, group, stream string, interval time.Duration) *cloudWatchWriter {
+	w := &cloudWatchWriter{svc: svc, group: group, stream: stream}
+	go func() {
+		for range time.Tick(interval) {
+			w.flush()
+		}
+	}()
+	return w
+}
+
+func (w *cloudWatchWriter) Write(p []byte) (int, error) {
+	message := string(p)
+	if len(message) > 0 && message[len(message)-1] == '\n' {
+		message = message[:len(message)-1]
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.events = append(w.events, types.InputLogEvent{
+		Message:   aws.String(message),
+		Timestamp: aws.Int64(time.Now().UnixMilli()),
+	})
+	if len(w.events) > cloudWatchMaxBuffered {
+		w.events = w.events[len(w.events)-cloudWatchMaxBuffered:]
+	}
+	return len(p), nil
+}
+
+// flush sends the buffered events. Errors are not logged, since that would
+// add more events, and the unsent events are kept for the next flush.
+func (w *cloudWatchWriter) flush() error {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+
+	// Send without holding mu, so logging does not block on the network
+	w.mu.Lock()
+	events := w.events
+	w.events = nil
+	w.mu.Unlock()
+
+	err := w.send(events)
+	if err != nil {
+		w.mu.Lock()
+		w.events = append(w.unsent, w.events...)
+		if len(w.events) > cloudWatchMaxBuffered {
+			w.events = w.events[len(w.events)-cloudWatchMaxBuffered:]
+		}
+		w.mu.Unlock()
+	}
+	return err
+}
+
+// send creates the log stream if needed and sends events in batches. The
+// events that could not be sent are left in unsent.
+func (w *cloudWatchWriter) send(events []types.InputLogEvent) error {
+	w.unsent = events
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if !w.created {
+		_, err := w.svc.CreateLogStream(ctx, &cloudwatchlogs.CreateLogStreamInput{
+			LogGroupName:  aws.String(w.group),
+			LogStreamName: aws.String(w.stream),
+		})
+		var exists *types.ResourceAlreadyExistsException
+		if err != nil && !errors.As(err, &exists) {
+			return err
+		}
+		w.created = true
+	}
+
+	for len(w.unsent) > 0 {
+		n, size := 0, 0
+		for n < len(w.unsent) && n < cloudWatchMaxBatchEvents {
+			size += len(aws.ToString(w.unsent[n].Message)) + cloudWatchEventOverhead
+			if size > cloudWatchMaxBatchBytes && n > 0 {
+				break
+			}
+			n++
+		}
+
+		_, err := w.svc.PutLogEvents(ctx, &cloudwatchlogs.PutLogEventsInput{
+			LogGroupName:  aws.String(w.group),
+			LogStreamName: aws.String(w.stream),
+			LogEvents:     w.unsent[:n],
+		})
+		if err != nil {
+			return err
+		}
+		w.unsent = w.unsent[n:]
+	}
+	return nil
+}
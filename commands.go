@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+
+	"flouret.io/update-route53/pkg/ipsource"
+	"flouret.io/update-route53/pkg/provider"
+	"flouret.io/update-route53/pkg/updater"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+)
+
+// runGet prints the current values of the records, one record per line. It
+// returns the process exit code.
+func runGet(svc *route53.Client, records []record) int {
+	u := newUpdater(svc)
+	exitCode := 0
+	for _, rec := range records {
+		values, ttl, err := u.RecordValues(context.TODO(), rec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", provider.DisplayName(rec.Name), err)
+			exitCode = 1
+			continue
+		}
+		if values == nil {
+			fmt.Printf("%s\t%s\t-\n", provider.DisplayName(rec.Name), rec.RecordType())
+			continue
+		}
+		fmt.Printf("%s\t%s\t%d\t%s\n", provider.DisplayName(rec.Name), rec.RecordType(), ttl, strings.Join(values, ","))
+	}
+	return exitCode
+}
+
+// updateOnce runs a single update cycle for the given record, bypassing
+// confirmations, the change cooldown and DRIFT_ACTION=alert.
+func updateOnce(svc *route53.Client, rec record) error {
+	u := newUpdater(svc,
+		updater.WithConfirmations(1, 0),
+		updater.WithMinChangeInterval(0),
+		updater.WithDriftAction(updater.DriftReassert))
+	return u.Update(context.TODO(), []record{rec})[0]
+}
+
+// runSet sets the record to the given address once, bypassing confirmations
+// and the change cooldown. It returns the process exit code.
+func runSet(svc *route53.Client, rec record, address string) int {
+	if rec.CNAMETarget != "" {
+		fmt.Fprintln(os.Stderr, "cannot set the address of a record in CNAME mode")
+		return 1
+	}
+
+	rec.StaticIP = address
+	if err := updateOnce(svc, rec); err != nil {
+		fmt.Fprintf(os.Stderr, "unable to set %s: %v\n", provider.DisplayName(rec.Name), err)
+		return 1
+	}
+	if stateFile != "" {
+		if err := saveState(stateFile); err != nil {
+			fmt.Fprintf(os.Stderr, "unable to save state: %v\n", err)
+			return 1
+		}
+	}
+	dnssecChecks.Wait()
+	return 0
+}
+
+// runHistoryPrune prunes the audit log like after each change, for one-shot
+// installs. It returns the process exit code.
+func runHistoryPrune() int {
+	if auditLogPath == "" {
+		fmt.Fprintln(os.Stderr, "AUDIT_LOG is not set")
+		return 1
+	}
+	if !auditRetention() {
+		fmt.Fprintln(os.Stderr, "AUDIT_LOG_MAX_ENTRIES or AUDIT_LOG_MAX_AGE must be set")
+		return 1
+	}
+	kept, pruned, err := pruneAuditLog()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to prune audit log: %v\n", err)
+		return 1
+	}
+	fmt.Printf("pruned %d entries, kept %d\n", pruned, kept)
+	return 0
+}
+
+// runDelete deletes the record, or only the value of this instance in merge
+// mode, like ON_SHUTDOWN=delete. It returns the process exit code.
+func runDelete(svc *route53.Client, rec record) int {
+	if err := cleanupRecord(svc, rec, shutdownActionDelete, nil); err != nil {
+		fmt.Fprintf(os.Stderr, "unable to delete %s: %v\n", provider.DisplayName(rec.Name), err)
+		return 1
+	}
+	if stateFile != "" {
+		if err := saveState(stateFile); err != nil {
+			fmt.Fprintf(os.Stderr, "unable to save state: %v\n", err)
+			return 1
+		}
+	}
+	return 0
+}
+
+// runNetworkHook updates the record once to the address reported by the pppd
+// or DHCP client hook that runs it, bypassing confirmations and the change
+// cooldown. Events that do not bring a new address are ignored. It returns
+// the process exit code.
+func runNetworkHook(svc *route53.Client, rec record) int {
+	if rec.CNAMETarget != "" {
+		fmt.Fprintln(os.Stderr, "cannot set the address of a record in CNAME mode")
+		return 1
+	}
+
+	address, err := hookAddress(rec.IPv6, rec.Suffix != "" || rec.IID != "")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if address == "" {
+		return 0
+	}
+
+	// The address goes through the suffix and interface identifier of the
+	// record, like a detected address, unlike set
+	rec.CheckIPURL, rec.Interface, rec.StaticIP = ipsource.Static(address).String(), "", ""
+	if err := updateOnce(svc, rec); err != nil {
+		fmt.Fprintf(os.Stderr, "unable to update %s: %v\n", provider.DisplayName(rec.Name), err)
+		return 1
+	}
+	if stateFile != "" {
+		if err := saveState(stateFile); err != nil {
+			fmt.Fprintf(os.Stderr, "unable to save state: %v\n", err)
+			return 1
+		}
+	}
+	dnssecChecks.Wait()
+	return 0
+}
+
+// hookAddress returns the address reported in the environment of a pppd
+// ip-up script or of a dhcpcd or dhclient hook, or an empty string if the
+// event does not bring a new address of the family of the record, such as a
+// lease expiring. Delegated prefixes are only used, and preferred, when the
+// record derives the host part of its address.
+func hookAddress(ipv6, prefix bool) (string, error) {
+	// pppd passes the local address of the link to ip-up scripts, and the
+	// link-local address only to ipv6-up scripts
+	if local := os.Getenv("IPLOCAL"); local != "" {
+		if ipv6 {
+			return "", errors.New("pppd does not report global ipv6 addresses")
+		}
+		return hookValue("IPLOCAL", local)
+	}
+
+	reason := os.Getenv("reason")
+	switch reason {
+	case "":
+		return "", errors.New("not run from a pppd, dhcpcd or dhclient hook")
+	case "BOUND", "RENEW", "REBIND", "REBOOT", "STATIC":
+		if ipv6 {
+			return "", nil
+		}
+		return hookValue("new_ip_address", os.Getenv("new_ip_address"))
+	case "BOUND6", "RENEW6", "REBIND6", "REBOOT6", "INFORM6":
+		if !ipv6 {
+			return "", nil
+		}
+		// dhcpcd and dhclient name the leased address and the delegated
+		// prefix differently
+		names := []string{"new_dhcp6_ia_na1_ia_addr1", "new_ip6_address"}
+		if prefix {
+			names = []string{"new_delegated_dhcp6_prefix", "new_ip6_prefix", "new_dhcp6_ia_na1_ia_addr1", "new_ip6_address"}
+		}
+		for _, name := range names {
+			if value := os.Getenv(name); value != "" {
+				return hookValue(name, value)
+			}
+		}
+		return "", nil
+	}
+	return "", nil
+}
+
+// hookValue parses an address or prefix from a hook variable. Variables may
+// list several values, of which the first one is used.
+func hookValue(name, value string) (string, error) {
+	value, _, _ = strings.Cut(strings.TrimSpace(value), " ")
+	if p, err := netip.ParsePrefix(value); err == nil {
+		return p.Addr().String(), nil
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid address %q in %s", value, name)
+	}
+	return addr.String(), nil
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"flouret.io/update-route53/pkg/provider"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+)
+
+// configOption describes a configuration environment variable
+type configOption struct {
+	Name        string
+	Description string
+	Default     string // Literal default value
+	DefaultNote string // Default that is not a literal value
+	Required    bool
+	Secret      bool   // Redacted when printing the configuration
+	Flag        string // Command line flag, if not derived from the name
+}
+
+// configOptions lists all supported environment variables
+var configOptions = []configOption{
+	{Name: "DNS_NAME", Description: "Host name to update", Required: true},
+	{Name: "HOSTED_ZONE_ID", Description: "Hosted zone id to update", Required: true, Flag: "zone-id"},
+	{Name: "DNS_TTL", Description: "TTL for the DNS record, from 0 to 2147483647 (a warning is logged below 30)", Default: "300", Flag: "ttl"},
+	{Name: "CHECK_IP", Description: "URL to check the public IP address, exec://<program> (see Custom Address Sources), imds:// (see EC2 Instance Metadata), ecs:// (see ECS Task Metadata) or tailscale:// (see Tailscale); several sources separated by commas are tried in order", Default: "http://checkip.amazonaws.com/"},
+	{Name: "SLEEP_PERIOD", Description: "Sleep period between IP address checks", Default: "5m"},
+	{Name: "LOCK_TABLE", Description: "DynamoDB table used to lock the record while it is being changed"},
+	{Name: "OWNER_ID", Description: "Identifier of this instance in the ownership TXT record"},
+	{Name: "FORCE_OWNERSHIP", Description: "Take ownership of records owned by someone else", Default: "false"},
+	{Name: "PROTECT_EXISTING", Description: "Refuse to modify records with values this instance never wrote, unless run with -force", Default: "false"},
+	{Name: "REQUIRE_EXISTING", Description: "Only update records that already exist, and fail if they are missing", Default: "false"},
+	{Name: "ON_SHUTDOWN", Description: "Action on graceful shutdown: delete or revert the record"},
+	{Name: "RUN_FOR", Description: "Exit cleanly after running for this duration, e.g. 24h, for periodic restarts"},
+	{Name: "STATIC_IP", Description: "Static address to enforce instead of detecting the public IP address"},
+	{Name: "INTERFACE", Description: "Network interface to read the address from instead of CHECK_IP"},
+	{Name: "RECORD_TYPE", Description: "Type of the record: A or AAAA", Default: "A"},
+	{Name: "IPV6_PREFIX_LENGTH", Description: "Length of the delegated prefix kept from the detected address, with IPV6_SUFFIX", Default: "64"},
+	{Name: "IPV6_SUFFIX", Description: "Host part of the AAAA record, appended to the delegated prefix (see IPv6 Prefix Delegation)"},
+	{Name: "IPV6_IID", Description: "Derive the interface identifier of the AAAA record: eui64:<mac> or stable:<secret>[@<mac>]"},
+	{Name: "IPV6_PREFIX_REWRITE", Description: "Also move the other AAAA records of the hosted zone to the new prefix when it changes", Default: "false"},
+	{Name: "PRIVATE_ZONE", Description: "Allow private addresses, for private hosted zones", Default: "false"},
+	{Name: "PRIVATE_HOSTED_ZONE_ID", Description: "Private hosted zone id to update with the LAN address (split-horizon)"},
+	{Name: "PRIVATE_INTERFACE", Description: "Network interface to read the LAN address from"},
+	{Name: "ALLOW_BOGON", Description: "Publish detected addresses even if they are in bogon ranges", Default: "false"},
+	{Name: "CONFIRMATIONS", Description: "Consecutive detections of a new address required before updating", Default: "1"},
+	{Name: "CONFIRMATION_INTERVAL", Description: "Interval between confirmation detections", Default: "10s"},
+	{Name: "MIN_CHANGE_INTERVAL", Description: "Minimum interval between consecutive changes of the record"},
+	{Name: "PROPAGATION_TIMEOUT", Description: "Maximum time to wait for a change to be in sync", Default: "10m"},
+	{Name: "DNSSEC_RESOLVER", Description: "Validating resolver checking the DNSSEC signatures of changes"},
+	{Name: "RETRY_ATTEMPTS", Description: "Attempts at detecting the address and at each AWS API call within a cycle", Default: "3"},
+	{Name: "RETRY_MAX_DELAY", Description: "Maximum delay between attempts, which doubles from 1s", Default: "20s"},
+	{Name: "THROTTLE_BACKOFF", Description: "Initial pause of the updates after AWS throttling, doubling with each throttled cycle", Default: "30s"},
+	{Name: "THROTTLE_MAX_BACKOFF", Description: "Maximum pause of the updates after AWS throttling", Default: "10m"},
+	{Name: "FAST_SLEEP_PERIOD", Description: "Sleep period used for a while after the record has changed"},
+	{Name: "FAST_PERIOD_WINDOW", Description: "How long the sleep period takes to decay from FAST_SLEEP_PERIOD back to normal after a change", Default: "30m"},
+	{Name: "SLEEP_JITTER", Description: "Random adjustment of each sleep period, as a fraction (e.g. 0.1 for ±10%)", Default: "0"},
+	{Name: "SCHEDULE", Description: "Cron expression to schedule update cycles instead of SLEEP_PERIOD"},
+	{Name: "WATCH_INTERFACE", Description: "Interface whose address changes trigger an immediate update (Linux only)"},
+	{Name: "TRIGGER_FILE", Description: "File that triggers an immediate update when touched"},
+	{Name: "MQTT_BROKER", Description: "MQTT broker URL", Secret: true},
+	{Name: "MQTT_USERNAME", Description: "MQTT username"},
+	{Name: "MQTT_PASSWORD", Description: "MQTT password", Secret: true},
+	{Name: "MQTT_CLIENT_ID", Description: "MQTT client id", DefaultNote: "Generated"},
+	{Name: "MQTT_TRIGGER_TOPIC", Description: "MQTT topic that triggers an immediate update"},
+	{Name: "MQTT_PUBLISH_TOPIC", Description: "MQTT topic to publish change events to"},
+	{Name: "FAILURE_THRESHOLD", Description: "Consecutive failed cycles before a failure notification is sent", Default: "3"},
+	{Name: "WEBHOOK_URL", Description: "URL to post change and failure events to", Secret: true},
+	{Name: "WEBHOOK_TEMPLATE", Description: "Go template for the webhook request body", DefaultNote: "JSON event"},
+	{Name: "WEBHOOK_SECRET", Description: "Secret used to sign webhook requests with HMAC-SHA256", Secret: true},
+	{Name: "WEBHOOK_RETRIES", Description: "Number of retries of failed webhook requests", Default: "3"},
+	{Name: "SLACK_WEBHOOK_URL", Description: "Slack incoming webhook URL for change and failure notifications", Secret: true},
+	{Name: "SLACK_CHANNEL", Description: "Slack channel override"},
+	{Name: "SLACK_USERNAME", Description: "Slack username override"},
+	{Name: "DISCORD_WEBHOOK_URL", Description: "Discord webhook URL for change and failure notifications", Secret: true},
+	{Name: "DISCORD_USERNAME", Description: "Discord username override"},
+	{Name: "SMTP_HOST", Description: "SMTP server for email notifications"},
+	{Name: "SMTP_PORT", Description: "SMTP server port", Default: "587"},
+	{Name: "SMTP_USERNAME", Description: "SMTP username"},
+	{Name: "SMTP_PASSWORD", Description: "SMTP password", Secret: true},
+	{Name: "SMTP_FROM", Description: "Sender address of email notifications"},
+	{Name: "SMTP_TO", Description: "Comma separated recipients of email notifications"},
+	{Name: "SMTP_STARTTLS", Description: "Use STARTTLS to encrypt the SMTP connection", Default: "true"},
+	{Name: "SMTP_SUBJECT_TEMPLATE", Description: "Go template for the email subject", DefaultNote: "Built-in"},
+	{Name: "SMTP_BODY_TEMPLATE", Description: "Go template for the email body", DefaultNote: "Built-in"},
+	{Name: "NTFY_URL", Description: "ntfy topic URL for change and failure notifications"},
+	{Name: "NTFY_TOKEN", Description: "ntfy access token", Secret: true},
+	{Name: "NTFY_PRIORITY", Description: "ntfy priority of change notifications", DefaultNote: "Server default"},
+	{Name: "NTFY_FAILURE_PRIORITY", Description: "ntfy priority of failure notifications", Default: "high"},
+	{Name: "NTFY_TAGS", Description: "Comma separated ntfy tags added to every notification"},
+	{Name: "NOTIFY_URLS", Description: "Comma separated shoutrrr service URLs for change and failure notifications", Secret: true},
+	{Name: "SNS_TOPIC_ARN", Description: "SNS topic to publish change and failure events to"},
+	{Name: "EVENT_BUS", Description: "EventBridge event bus to put change events on"},
+	{Name: "PRE_UPDATE_HOOK", Description: "Command to run before the record is changed"},
+	{Name: "POST_UPDATE_HOOK", Description: "Command to run after the change has propagated"},
+	{Name: "HOOK_TIMEOUT", Description: "Maximum run time of hook commands", Default: "1m"},
+	{Name: "WIREGUARD_PEERS", Description: "Comma separated WireGuard peers to point at the new address after a change, as <interface>:<public key>@<host>:<port>"},
+	{Name: "NOTIFY_CHANGE_TEMPLATE", Description: "Go template for the message of change notifications", DefaultNote: "Built-in"},
+	{Name: "NOTIFY_FAILURE_TEMPLATE", Description: "Go template for the message of failure notifications", DefaultNote: "Built-in"},
+	{Name: "NOTIFY_REMINDER_INTERVAL", Description: "Minimum interval between failure reminders of each notifier", Default: "1h"},
+	{Name: "NOTIFY_RECOVERY_TEMPLATE", Description: "Go template for the message of recovery notifications", DefaultNote: "Built-in"},
+	{Name: "STATE_FILE", Description: "File to persist the state of the records across restarts"},
+	{Name: "AUDIT_LOG", Description: "Append-only file recording every submitted change, one JSON object per line"},
+	{Name: "AUDIT_LOG_MAX_ENTRIES", Description: "Maximum number of entries kept in the audit log", DefaultNote: "Unlimited"},
+	{Name: "AUDIT_LOG_MAX_AGE", Description: "Maximum age of the entries kept in the audit log", DefaultNote: "Unlimited"},
+	{Name: "VERIFY_INTERVAL", Description: "Interval between reads of the record from Route53, using a cached value in between", DefaultNote: "Every cycle"},
+	{Name: "ROUTE53_DAILY_BUDGET", Description: "Route53 API calls per day after which the records are no longer read", DefaultNote: "Unlimited"},
+	{Name: "RECORD_SOURCE", Description: "How to read the current record value: api (Route53 API) or dns (authoritative nameservers)", Default: "api"},
+	{Name: "MULTI_VALUE_MODE", Description: "How to update record sets with multiple values: replace or merge (only replace the value of this instance)", Default: "replace"},
+	{Name: "DRIFT_ACTION", Description: "What to do when the record was changed by someone else: reassert or alert", Default: "reassert"},
+	{Name: "ROUTING_POLICY", Description: "Routing policy of the record: simple, multivalue, weighted, geolocation or failover", Default: "simple"},
+	{Name: "SET_IDENTIFIER", Description: "Identifier of this member of a routed record set", DefaultNote: "Hostname"},
+	{Name: "HEALTH_CHECK_ID", Description: "Route53 health check to associate with the record"},
+	{Name: "WEIGHT", Description: "Weight of the record, from 0 to 255"},
+	{Name: "GEO_CONTINENT", Description: "Continent code of the record, for geolocation routing"},
+	{Name: "GEO_COUNTRY", Description: "Country code of the record (* for the default location), for geolocation routing"},
+	{Name: "GEO_SUBDIVISION", Description: "Subdivision code of the record, for geolocation routing"},
+	{Name: "FAILOVER", Description: "PRIMARY or SECONDARY"},
+	{Name: "HEALTH_CHECK_TYPE", Description: "Create and maintain a health check of this type: HTTP, HTTPS or TCP"},
+	{Name: "HEALTH_CHECK_PORT", Description: "Port probed by the managed health check", DefaultNote: "80 or 443"},
+	{Name: "HEALTH_CHECK_PATH", Description: "Path requested by the managed HTTP(S) health check", Default: "/"},
+	{Name: "REPLACE_ALIAS", Description: "Replace an alias record with a plain A record instead of refusing to update it", Default: "false"},
+	{Name: "METADATA_RECORD", Description: "Name of a TXT record to update with metadata about each change"},
+	{Name: "SRV_RECORD", Description: "Name of an SRV record to maintain"},
+	{Name: "SRV_TARGET", Description: "Target of the SRV record", DefaultNote: "DNS_NAME"},
+	{Name: "SRV_PORT", Description: "Port of the SRV record"},
+	{Name: "SRV_PORT_FILE", Description: "File containing the port of the SRV record, read on every cycle"},
+	{Name: "SRV_PRIORITY", Description: "Priority of the SRV record", Default: "0"},
+	{Name: "SRV_WEIGHT", Description: "Weight of the SRV record", Default: "0"},
+	{Name: "CNAME_TARGET", Description: "Maintain a CNAME to this name instead of an A record"},
+	{Name: "REVERSE_HOSTED_ZONE_ID", Description: "Route53 hosted zone id of the reverse zone in which to maintain the PTR record"},
+	{Name: "PRIVATE_DNS_TTL", Description: "TTL of the private record (split-horizon)", DefaultNote: "DNS_TTL"},
+	{Name: "RECORDS", Description: "Additional records to manage, see Additional Records"},
+	{Name: "EXEC_TIMEOUT", Description: "Maximum run time of an exec:// address source", Default: "30s"},
+	{Name: "CIRCUIT_BREAKER_THRESHOLD", Description: "Consecutive failures after which a CHECK_IP source is skipped (0 to disable)", Default: "3"},
+	{Name: "CIRCUIT_BREAKER_COOLDOWN", Description: "How long a failing CHECK_IP source is skipped before it is tried again", Default: "5m"},
+	{Name: "CHECK_IP_TIMEOUT", Description: "Maximum time an attempt of an address source may take before it fails", Default: "30s"},
+	{Name: "CHECK_IP_NO_KEEPALIVE", Description: "Open a new connection for every check IP request", Default: "false"},
+	{Name: "CHECK_IP_BIND_ADDRESS", Description: "Local address to send check IP requests from"},
+	{Name: "CHECK_IP_BIND_INTERFACE", Description: "Network interface to send check IP requests through"},
+	{Name: "CHECK_IP_ORDER", Description: "Order in which comma-separated CHECK_IP sources are tried: fixed or adaptive", Default: "fixed"},
+	{Name: "PORT", Description: "Port of the health check and metrics server, also queried by the healthcheck and status commands", Default: "8080"},
+	{Name: "ADMIN_SOCKET", Description: "Unix socket serving the health check, metrics and status endpoints"},
+	{Name: "LOG_LEVEL", Description: "Log level: trace, debug, info, warn or error", Default: "info"},
+	{Name: "LOG_FORMAT", Description: "Log format: json, console, logfmt or pretty-json", Default: "json"},
+	{Name: "LOG_OUTPUT", Description: "Log output: stdout, syslog or journald", Default: "stdout"},
+	{Name: "UNCHANGED_LOG_EVERY", Description: "Log unchanged cycles at info level every N cycles, and at debug level otherwise (0 for always debug)", Default: "1"},
+	{Name: "CLOUDWATCH_LOG_GROUP", Description: "CloudWatch Logs group to also ship logs to"},
+	{Name: "CLOUDWATCH_LOG_STREAM", Description: "CloudWatch Logs stream, created if needed", DefaultNote: "Hostname"},
+	{Name: "CLOUDWATCH_FLUSH_INTERVAL", Description: "Interval between batches of logs sent to CloudWatch Logs", Default: "5s"},
+	{Name: "LOKI_URL", Description: "Loki push API URL to also ship logs to, e.g. http://loki:3100/loki/api/v1/push", Secret: true},
+	{Name: "LOKI_LABELS", Description: "Additional Loki stream labels, as name=value pairs separated by commas", DefaultNote: "job=update-route53,host=<hostname>"},
+	{Name: "LOKI_FLUSH_INTERVAL", Description: "Interval between batches of logs pushed to Loki", Default: "5s"},
+	{Name: "LEADER_ELECTION_LEASE", Description: "Name of the lease used with -leader-elect", Default: "update-route53"},
+	{Name: "WATCH_NAMESPACE", Description: "Namespace watched for DNSRecord resources with -operator", DefaultNote: "Namespace of the pod"},
+}
+
+// flagName returns the command line flag of the option: the lower case name
+// with dashes, e.g. -sleep-period for SLEEP_PERIOD.
+func (opt configOption) flagName() string {
+	if opt.Flag != "" {
+		return opt.Flag
+	}
+	return strings.ReplaceAll(strings.ToLower(opt.Name), "_", "-")
+}
+
+// registerConfigFlags adds a command line flag for each option to fs.
+func registerConfigFlags(fs *flag.FlagSet) {
+	for _, opt := range configOptions {
+		usage := opt.Description
+		if opt.DefaultNote != "" {
+			usage += " (default " + opt.DefaultNote + ")"
+		}
+		fs.String(opt.flagName(), opt.Default, usage)
+	}
+}
+
+// loadFileOptions sets the environment variable of each option from the
+// file named by the same variable with a _FILE suffix, e.g. SMTP_PASSWORD
+// from the contents of SMTP_PASSWORD_FILE, for secrets mounted as files.
+func loadFileOptions() error {
+	for _, opt := range configOptions {
+		path := os.Getenv(opt.Name + "_FILE")
+		if path == "" {
+			continue
+		}
+		if os.Getenv(opt.Name) != "" {
+			return fmt.Errorf("both %s and %s_FILE are set", opt.Name, opt.Name)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("unable to read %s_FILE: %w", opt.Name, err)
+		}
+		if err := os.Setenv(opt.Name, strings.TrimRight(string(data), "\r\n")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyConfigFlags sets the environment variable of each option passed on
+// the command line, so flags take precedence over the environment.
+func applyConfigFlags(fs *flag.FlagSet) error {
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		for _, opt := range configOptions {
+			if f.Name == opt.flagName() && err == nil {
+				err = os.Setenv(opt.Name, f.Value.String())
+			}
+		}
+	})
+	return err
+}
+
+// redacted replaces the value of secret options in printed configurations
+const redacted = "REDACTED"
+
+// printConfig writes the effective configuration as environment variable
+// assignments, with unset options commented out along with their default.
+func printConfig(w io.Writer) {
+	for _, opt := range configOptions {
+		value, ok := os.LookupEnv(opt.Name)
+		switch {
+		case !ok || value == "":
+			def := opt.Default
+			switch {
+			case opt.DefaultNote != "":
+				def = opt.DefaultNote
+			case def == "":
+				def = "disabled"
+			}
+			fmt.Fprintf(w, "# %s is not set (default: %s)\n", opt.Name, def)
+		case opt.Secret:
+			fmt.Fprintf(w, "%s=%s\n", opt.Name, redacted)
+		default:
+			fmt.Fprintf(w, "%s=%s\n", opt.Name, value)
+		}
+	}
+}
+
+// printSampleConfig writes a commented sample environment file with all
+// options: required options are left empty, other options are commented out
+// and set to their default if it is a literal value.
+func printSampleConfig(w io.Writer) {
+	fmt.Fprintln(w, "# update-route53 configuration")
+	for _, opt := range configOptions {
+		fmt.Fprintf(w, "\n# %s\n", opt.Description)
+		switch {
+		case opt.Required:
+			fmt.Fprintf(w, "%s=\n", opt.Name)
+		case opt.DefaultNote != "":
+			fmt.Fprintf(w, "# Default: %s\n#%s=\n", opt.DefaultNote, opt.Name)
+		case opt.Default == "":
+			fmt.Fprintf(w, "# Not set by default\n#%s=\n", opt.Name)
+		default:
+			fmt.Fprintf(w, "#%s=%s\n", opt.Name, opt.Default)
+		}
+	}
+}
+
+// checkRecordAccess verifies that the hosted zones of records exist, that
+// each record name belongs to its zone, and that its record set can be read.
+func checkRecordAccess(svc *route53.Client, records []record) error {
+	zoneNames := make(map[string]string)
+	for _, rec := range records {
+		if rec.Name == "" {
+			continue // Operator mode without DNS_NAME
+		}
+
+		zoneName, ok := zoneNames[rec.HostedZoneId]
+		if !ok {
+			zone, err := svc.GetHostedZone(context.TODO(), &route53.GetHostedZoneInput{
+				Id: aws.String(rec.HostedZoneId),
+			})
+			if err != nil {
+				return fmt.Errorf("unable to get hosted zone %s: %w", rec.HostedZoneId, err)
+			}
+			zoneName = aws.ToString(zone.HostedZone.Name)
+			zoneNames[rec.HostedZoneId] = zoneName
+		}
+
+		name := strings.ToLower(strings.TrimSuffix(provider.UnescapeName(rec.Name), "."))
+		zoneName = strings.ToLower(strings.TrimSuffix(provider.UnescapeName(zoneName), "."))
+		if name != zoneName && !strings.HasSuffix(name, "."+zoneName) {
+			return fmt.Errorf("%s is not in hosted zone %s (%s)", provider.DisplayName(rec.Name), rec.HostedZoneId, provider.DisplayName(zoneName))
+		}
+
+		if _, err := getRecordSet(svc, rec); err != nil {
+			return fmt.Errorf("unable to read record %s: %w", provider.DisplayName(rec.Name), err)
+		}
+	}
+	return nil
+}
+
+// runConfigValidate is called by `config validate` once the configuration
+// has been parsed (parsing errors are fatal), optionally checks access to the
+// records with the Route53 API, prints the effective configuration and
+// returns the process exit code.
+func runConfigValidate(svc *route53.Client, records []record, checkAWS bool) int {
+	if checkAWS {
+		if err := checkRecordAccess(svc, records); err != nil {
+			fmt.Fprintf(os.Stderr, "configuration check failed: %v\n", err)
+			return 1
+		}
+	}
+
+	printConfig(os.Stdout)
+	return 0
+}
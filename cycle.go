@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"flouret.io/update-route53/pkg/provider"
+	"flouret.io/update-route53/pkg/updater"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/rs/zerolog"
+)
+
+// cycleID holds the id of the running update cycle, empty between cycles.
+var cycleID atomic.Value
+
+// startCycle assigns a new short random id to the update cycle that starts.
+func startCycle() {
+	b := make([]byte, 4)
+	rand.Read(b)
+	cycleID.Store(hex.EncodeToString(b))
+}
+
+// endCycle clears the id once the update cycle is done.
+func endCycle() {
+	cycleID.Store("")
+}
+
+// currentCycle returns the id of the running update cycle, or "".
+func currentCycle() string {
+	id, _ := cycleID.Load().(string)
+	return id
+}
+
+// cycleHook adds the id of the running update cycle to log events, so the
+// messages of a cycle can be correlated.
+type cycleHook struct{}
+
+func (cycleHook) Run(e *zerolog.Event, level zerolog.Level, msg string) {
+	if id := currentCycle(); id != "" {
+		e.Str("cycle", id)
+	}
+}
+
+// changeComment returns the comment of change batches, which identifies the
+// update cycle that submitted them.
+func changeComment() string {
+	if id := currentCycle(); id != "" {
+		return "update-route53 cycle " + id
+	}
+	return "update-route53"
+}
+
+// newProvider returns the Route53 provider used to submit changes, with the
+// comment of the running update cycle.
+func newProvider(svc *route53.Client) *provider.Route53 {
+	p := provider.New(svc)
+	p.Comment = changeComment()
+	return p
+}
+
+// recordUpdater runs the update cycles of the records, with the options of
+// the environment.
+var recordUpdater *updater.Updater
+
+// newUpdater returns an Updater running the update cycle with the options of
+// the environment, followed by the given options, and the hooks of this
+// program: ownership, locking, health checks, companion records, audit log,
+// notifications and update hooks.
+func newUpdater(svc *route53.Client, opts ...updater.Option) *updater.Updater {
+	hooks := updater.Hooks{
+		Detect:   detectSource,
+		SkipRead: overBudget,
+		Drifted:  notifyDrift,
+		Check: func(ctx context.Context, rec record, logger zerolog.Logger, exists bool) error {
+			return checkClaim(svc, rec, logger, exists)
+		},
+		BeforeChange: func(ctx context.Context, c *updater.Change) error {
+			return beforeChange(svc, c)
+		},
+		Companions: companionChanges,
+		Submitted:  auditBatch,
+		Changed: func(ctx context.Context, c *updater.Change) {
+			afterChange(svc, c)
+		},
+		Comment: changeComment,
+	}
+	if locker != nil {
+		hooks.Lock = func(ctx context.Context, rec record) (func(), error) {
+			return locker.acquire(ctx, rec.Key())
+		}
+	}
+
+	u, err := updater.New(svc, append([]updater.Option{
+		updater.WithLogger(logger),
+		updater.WithState(state),
+		updater.WithHooks(hooks),
+		updater.WithAllowBogon(allowBogon),
+		updater.WithVerifyInterval(verifyInterval),
+		updater.WithDNSLookups(recordSource == recordSourceDNS),
+		updater.WithReplaceAlias(replaceAlias),
+		updater.WithRequireExisting(requireExisting),
+		updater.WithMergeValues(multiValueMode == multiValueMerge),
+		updater.WithDriftAction(driftAction),
+		updater.WithConfirmations(confirmations, confirmationInterval),
+		updater.WithMinChangeInterval(minChangeInterval),
+		updater.WithPropagationTimeout(propagationTimeout),
+		updater.WithPrefixRewrite(ipv6PrefixRewrite),
+		updater.WithUnchangedLogEvery(unchangedLogEvery),
+	}, opts...)...)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("unable to create updater")
+	}
+	return u
+}
+
+// beforeChange runs the pre-update hook, which can veto the change, and
+// points the managed health check of the record at the new address.
+// Failures are logged and returned.
+func beforeChange(svc *route53.Client, c *updater.Change) error {
+	if preUpdateHook != "" {
+		err := runHook(preUpdateHook, map[string]string{
+			"OLD_IP": strings.Join(c.Current, ","),
+			"NEW_IP": c.Address,
+			"RECORD": c.Record.Name,
+		})
+		if err != nil {
+			c.Logger.Err(err).Msg("pre-update hook failed, skipping update")
+			return fmt.Errorf("pre-update hook failed: %w", err)
+		}
+	}
+
+	if c.Record.ManageHealthCheck {
+		if err := syncHealthCheck(svc, c.Record, c.State, c.Address); err != nil {
+			c.Logger.Err(err).Msg("unable to update health check")
+			return fmt.Errorf("unable to update health check: %w", err)
+		}
+		c.Record.HealthCheckId = c.State.HealthCheckId
+		c.Logger = c.Logger.With().Str("healthCheckId", c.Record.HealthCheckId).Logger()
+	}
+	return nil
+}
+
+// companionChanges returns the changes of the owner and metadata records
+// submitted along with the change of a record.
+func companionChanges(c *updater.Change) []types.Change {
+	var changes []types.Change
+	if ownerID != "" {
+		changes = append(changes, ownerChange(c.Record))
+	}
+	if metadataRecord != "" && c.Record.HostedZoneId == hostedZoneId && c.Record.CNAMETarget == "" {
+		changes = append(changes, metadataChange(c.Record, c.Address))
+	}
+	return changes
+}
+
+// auditBatch writes the changes of a batch of records to the audit log.
+func auditBatch(zone, changeId string, changes []types.Change, batch []*updater.Change) {
+	old := map[string][]string{}
+	for _, c := range batch {
+		old[auditKey(c.Record.Name, c.Record.RecordType(), c.Record.SetIdentifier)] = c.Current
+	}
+	auditChanges(zone, changeId, changes, old)
+}
+
+// afterChange runs what follows a change of a record: notifications, and
+// for A and AAAA records the DNSSEC check, PTR record, WireGuard peers and
+// post-update hook.
+func afterChange(svc *route53.Client, c *updater.Change) {
+	rec, logger := c.Record, c.Logger
+	currentRecordValue := strings.Join(c.Current, ",")
+
+	notify(event{
+		Type:          eventChange,
+		Record:        rec.Name,
+		HostedZoneId:  rec.HostedZoneId,
+		RecordType:    string(rec.RecordType()),
+		SetIdentifier: rec.SetIdentifier,
+		OldAddress:    currentRecordValue,
+		NewAddress:    c.Address,
+		TTL:           rec.TTL,
+		ChangeId:      c.ChangeId,
+		Timestamp:     time.Now().UTC(),
+
+		PropagationSeconds: c.Propagation.Seconds(),
+	})
+	if rec.CNAMETarget != "" {
+		return
+	}
+
+	// Check that validating resolvers accept the signatures of the new values
+	if dnssecResolver != "" {
+		checkDNSSEC(logger, rec, c.Address, c.Values)
+	}
+
+	// Keep the reverse record consistent with the forward record
+	if reverseHostedZoneId != "" && rec.HostedZoneId == hostedZoneId {
+		if err := updatePTR(svc, rec, updater.DroppedValues(c.Current, c.Values), c.Address); err != nil {
+			logger.Err(err).Msg("unable to update PTR record")
+		}
+	}
+
+	// Point the WireGuard peers at the record to the new address
+	refreshWireGuardPeers(rec, c.Address)
+
+	// Run the post-update hook
+	if postUpdateHook != "" {
+		err := runHook(postUpdateHook, map[string]string{
+			"OLD_IP":    currentRecordValue,
+			"NEW_IP":    c.Address,
+			"RECORD":    rec.Name,
+			"CHANGE_ID": c.ChangeId,
+		})
+		if err != nil {
+			logger.Err(err).Msg("post-update hook failed")
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Embed colors for Discord messages
+const (
+	discordColorChange  = 0x2ecc71
+	discordColorFailure = 0xe74c3c
+)
+
+// discordNotifier posts events to a Discord webhook as embeds.
+type discordNotifier struct {
+	url      string
+	username string
+	client   *http.Client
+}
+
+type discordEmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline,omitempty"`
+}
+
+type discordEmbed struct {
+	Title       string              `json:"title"`
+	Description string              `json:"description,omitempty"`
+	Color       int                 `json:"color"`
+	Fields      []discordEmbedField `json:"fields"`
+	Timestamp   string              `json:"timestamp"`
+}
+
+func newDiscordNotifier(url, username string) *discordNotifier {
+	return &discordNotifier{
+		url:      url,
+		username: username,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (n *discordNotifier) name() string {
+	return "discord"
+}
+
+func (n *discordNotifier) notify(ev event) error {
+	embed := discordEmbed{
+		Timestamp: ev.Timestamp.Format(time.RFC3339),
+	}
+	switch ev.Type {
+	case eventChange:
+		embed.Title = fmt.Sprintf("%s changed", ev.Record)
+		embed.Color = discordColorChange
+		embed.Fields = []discordEmbedField{
+			{Name: "Old address", Value: valueOrNone(ev.OldAddress), Inline: true},
+			{Name: "New address", Value: ev.NewAddress, Inline: true},
+			{Name: "Propagation", Value: fmt.Sprintf("%.0fs", ev.PropagationSeconds), Inline: true},
+		}
+	case eventFailure:
+		embed.Title = fmt.Sprintf("%s update failing", ev.Record)
+		embed.Color = discordColorFailure
+		embed.Fields = []discordEmbedField{
+			{Name: "Error", Value: ev.Error},
+		}
+	case eventRecovery:
+		embed.Title = fmt.Sprintf("%s recovered", ev.Record)
+		embed.Color = discordColorChange
+		embed.Description = "Updates are succeeding again"
+	case eventDrift:
+		embed.Title = fmt.Sprintf("%s changed externally", ev.Record)
+		embed.Color = discordColorFailure
+		embed.Fields = []discordEmbedField{
+			{Name: "Written address", Value: ev.OldAddress, Inline: true},
+			{Name: "Current values", Value: valueOrNone(ev.NewAddress), Inline: true},
+		}
+	case eventBudget:
+		embed.Title = "Route53 API budget exceeded"
+		embed.Color = discordColorFailure
+		embed.Description = ev.Error
+	case eventDNSSEC:
+		embed.Title = fmt.Sprintf("%s DNSSEC validation failed", ev.Record)
+		embed.Color = discordColorFailure
+		embed.Fields = []discordEmbedField{
+			{Name: "Address", Value: ev.NewAddress, Inline: true},
+			{Name: "Error", Value: ev.Error},
+		}
+	default:
+		return nil
+	}
+	if hasMessageTemplate(ev) {
+		embed.Description = eventMessage(ev)
+		embed.Fields = nil
+	}
+
+	payload := map[string]any{"embeds": []discordEmbed{embed}}
+	if n.username != "" {
+		payload["username"] = n.username
+	}
+	return postJSON(n.client, n.url, payload)
+}
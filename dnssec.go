@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"flouret.io/update-route53/pkg/updater"
+	"github.com/rs/zerolog"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// typeRRSIG is the type of DNSSEC signature records, which dnsmessage does
+// not parse.
+const typeRRSIG dnsmessage.Type = 46
+
+// dnssecChecks tracks the DNSSEC validations running in the background, so
+// one-shot commands can wait for them before exiting.
+var dnssecChecks sync.WaitGroup
+
+// parseResolver parses the address of a DNS resolver, with port 53 by
+// default.
+func parseResolver(s string) (string, error) {
+	if _, _, err := net.SplitHostPort(s); err == nil {
+		return s, nil
+	}
+	host := strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	if host == "" {
+		return "", fmt.Errorf("invalid resolver %q", s)
+	}
+	return net.JoinHostPort(host, "53"), nil
+}
+
+// checkDNSSEC validates in the background that the record resolves to its
+// new values with DNSSEC through dnssecResolver, and notifies a dnssec event
+// if it does not. The resolver may answer from its cache until the TTL of the
+// old values expires, so the check is retried until then.
+func checkDNSSEC(logger zerolog.Logger, rec record, address string, values []string) {
+	// Only the values of this instance are known to be answered with routing
+	// policies other than simple and multivalue
+	want := values
+	switch {
+	case rec.SetIdentifier == "":
+	case rec.RoutingPolicy == updater.RoutingMultivalue:
+		want = []string{address}
+	default:
+		want = nil
+	}
+
+	logger = logger.With().Str("resolver", dnssecResolver).Logger()
+	deadline := time.Now().Add(time.Duration(rec.TTL)*time.Second + time.Minute)
+	dnssecChecks.Add(1)
+	go func() {
+		defer dnssecChecks.Done()
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			err := validateDNSSEC(ctx, rec.Name, rec.RecordType() == "AAAA", want)
+			cancel()
+			if err == nil {
+				logger.Info().Msg("dnssec validated")
+				return
+			}
+			if time.Now().After(deadline) {
+				logger.Err(err).Msg("dnssec validation failed")
+				notify(event{
+					Type:          eventDNSSEC,
+					Record:        rec.Name,
+					HostedZoneId:  rec.HostedZoneId,
+					RecordType:    string(rec.RecordType()),
+					SetIdentifier: rec.SetIdentifier,
+					NewAddress:    address,
+					Error:         err.Error(),
+					Timestamp:     time.Now().UTC(),
+				})
+				return
+			}
+			logger.Debug().Err(err).Msg("dnssec not validated yet")
+			time.Sleep(10 * time.Second)
+		}
+	}()
+}
+
+// validateDNSSEC queries dnssecResolver for the addresses of the record, and
+// checks that the answer holds the wanted values, is authenticated, and is
+// covered by a current signature.
+func validateDNSSEC(ctx context.Context, name string, ipv6 bool, want []string) error {
+	qtype := dnsmessage.TypeA
+	if ipv6 {
+		qtype = dnsmessage.TypeAAAA
+	}
+	msg, err := queryResolver(ctx, dnssecResolver, name, qtype)
+	if err != nil {
+		return err
+	}
+
+	switch msg.RCode {
+	case dnsmessage.RCodeSuccess:
+	case dnsmessage.RCodeServerFailure:
+		return errors.New("resolver answered SERVFAIL, the signatures may be invalid")
+	default:
+		return fmt.Errorf("resolver answered %s", strings.TrimPrefix(msg.RCode.String(), "RCode"))
+	}
+
+	var answered []string
+	var signature *dnsmessage.UnknownResource
+	for _, rr := range msg.Answers {
+		switch body := rr.Body.(type) {
+		case *dnsmessage.AResource:
+			answered = append(answered, netip.AddrFrom4(body.A).String())
+		case *dnsmessage.AAAAResource:
+			answered = append(answered, netip.AddrFrom16(body.AAAA).String())
+		case *dnsmessage.UnknownResource:
+			if rr.Header.Type == typeRRSIG && len(body.Data) >= 18 && dnsmessage.Type(binary.BigEndian.Uint16(body.Data)) == qtype {
+				signature = body
+			}
+		}
+	}
+	for _, value := range want {
+		if !slices.Contains(answered, value) {
+			return fmt.Errorf("resolver answers %s instead of %s", valueOrNone(strings.Join(answered, ",")), strings.Join(want, ","))
+		}
+	}
+
+	if !msg.AuthenticData {
+		return errors.New("answer is not authenticated, the zone is not signed or the resolver does not validate")
+	}
+	if signature == nil {
+		return fmt.Errorf("no RRSIG covers the %s records", strings.TrimPrefix(qtype.String(), "Type"))
+	}
+	// Signature expiration and inception times, in seconds since the epoch
+	now := uint32(time.Now().Unix())
+	expiration := binary.BigEndian.Uint32(signature.Data[8:])
+	inception := binary.BigEndian.Uint32(signature.Data[12:])
+	if int32(expiration-now) < 0 || int32(now-inception) < 0 {
+		return fmt.Errorf("RRSIG is only valid from %s to %s",
+			time.Unix(int64(inception), 0).UTC().Format(time.RFC3339),
+			time.Unix(int64(expiration), 0).UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// queryResolver sends a recursive query with the DNSSEC OK bit to a resolver
+// over UDP, and over TCP if the answer is truncated.
+func queryResolver(ctx context.Context, resolver, name string, qtype dnsmessage.Type) (*dnsmessage.Message, error) {
+	qname, err := dnsmessage.NewName(strings.TrimSuffix(name, ".") + ".")
+	if err != nil {
+		return nil, err
+	}
+	id := uint16(rand.Uint32())
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, RecursionDesired: true, AuthenticData: true})
+	b.StartQuestions()
+	b.Question(dnsmessage.Question{Name: qname, Type: qtype, Class: dnsmessage.ClassINET})
+	b.StartAdditionals()
+	var opt dnsmessage.ResourceHeader
+	opt.SetEDNS0(4096, dnsmessage.RCodeSuccess, true)
+	b.OPTResource(opt, dnsmessage.OPTResource{})
+	query, err := b.Finish()
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := exchange(ctx, "udp", resolver, query)
+	if err == nil && msg.Truncated {
+		msg, err = exchange(ctx, "tcp", resolver, query)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to query %s: %w", resolver, err)
+	}
+	if msg.ID != id || !msg.Response {
+		return nil, fmt.Errorf("unexpected answer from %s", resolver)
+	}
+	return msg, nil
+}
+
+// exchange sends a DNS message and reads the answer, with the length prefix
+// of TCP messages.
+func exchange(ctx context.Context, network, resolver string, query []byte) (*dnsmessage.Message, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, resolver)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	var answer []byte
+	if network == "tcp" {
+		if _, err := conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(query))), query...)); err != nil {
+			return nil, err
+		}
+		var length [2]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return nil, err
+		}
+		answer = make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(conn, answer); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err := conn.Write(query); err != nil {
+			return nil, err
+		}
+		answer = make([]byte, 65535)
+		n, err := conn.Read(answer)
+		if err != nil {
+			return nil, err
+		}
+		answer = answer[:n]
+	}
+
+	var msg dnsmessage.Message
+	if err := msg.Unpack(answer); err != nil {
+		return nil, fmt.Errorf("invalid answer: %w", err)
+	}
+	return &msg, nil
+}
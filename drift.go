@@ -0,0 +1,21 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+// notifyDrift notifies a change of the record by someone else, found by the
+// update cycle.
+func notifyDrift(rec record, st *recordState, values []string) {
+	notify(event{
+		Type:          eventDrift,
+		Record:        rec.Name,
+		HostedZoneId:  rec.HostedZoneId,
+		RecordType:    string(rec.RecordType()),
+		SetIdentifier: rec.SetIdentifier,
+		OldAddress:    st.OwnValue,
+		NewAddress:    strings.Join(values, ","),
+		Timestamp:     time.Now().UTC(),
+	})
+}
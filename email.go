@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Default email templates
+const (
+	defaultEmailSubject = `[update-route53] {{ if eq .Type "budget" }}Route53 API budget exceeded{{ else }}{{ .Record }} {{ if eq .Type "change" }}changed to {{ .NewAddress }}{{ else if eq .Type "recovery" }}recovered{{ else if eq .Type "dnssec" }}DNSSEC validation failed{{ else if eq .Type "drift" }}changed externally{{ else }}update failing{{ end }}{{ end }}`
+	defaultEmailBody    = `{{ if eq .Type "change" -}}
+The record {{ .Record }} in hosted zone {{ .HostedZoneId }} was changed.
+
+Old address: {{ or .OldAddress "none" }}
+New address: {{ .NewAddress }}
+TTL:         {{ .TTL }}
+Change:      {{ .ChangeId }}
+Propagation: {{ printf "%.0f" .PropagationSeconds }}s
+{{- else if eq .Type "recovery" -}}
+Updates of the record {{ .Record }} in hosted zone {{ .HostedZoneId }} are succeeding again.
+{{- else if eq .Type "dnssec" -}}
+The record {{ .Record }} in hosted zone {{ .HostedZoneId }} was changed to {{ .NewAddress }}, but does not pass DNSSEC validation.
+
+Error: {{ .Error }}
+{{- else if eq .Type "budget" -}}
+{{ .Error }}
+{{- else if eq .Type "drift" -}}
+The record {{ .Record }} in hosted zone {{ .HostedZoneId }} was changed by someone else.
+
+Written address: {{ .OldAddress }}
+Current values:  {{ or .NewAddress "none" }}
+{{- else -}}
+Updating the record {{ .Record }} in hosted zone {{ .HostedZoneId }} keeps failing.
+
+Error: {{ .Error }}
+{{- end }}
+
+Time: {{ .Timestamp }}
+`
+)
+
+// emailNotifier sends events by email through an SMTP server.
+type emailNotifier struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     string
+	to       []string
+	startTLS bool
+	subject  *template.Template
+	body     *template.Template
+}
+
+func newEmailNotifier(host, port, username, password, from, to string, startTLS bool, subject, body string) (*emailNotifier, error) {
+	if subject == "" {
+		subject = defaultEmailSubject
+	}
+	if body == "" {
+		body = defaultEmailBody
+	}
+
+	n := &emailNotifier{
+		host:     host,
+		port:     port,
+		username: username,
+		password: password,
+		from:     from,
+		startTLS: startTLS,
+	}
+	for _, addr := range strings.Split(to, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			n.to = append(n.to, addr)
+		}
+	}
+
+	var err error
+	if n.subject, err = template.New("subject").Funcs(templateFuncs).Parse(subject); err != nil {
+		return nil, fmt.Errorf("invalid subject template: %w", err)
+	}
+	if n.body, err = template.New("body").Funcs(templateFuncs).Parse(body); err != nil {
+		return nil, fmt.Errorf("invalid body template: %w", err)
+	}
+	return n, nil
+}
+
+func (n *emailNotifier) name() string {
+	return "email"
+}
+
+func (n *emailNotifier) notify(ev event) error {
+	var subject, body bytes.Buffer
+	if err := n.subject.Execute(&subject, ev); err != nil {
+		return fmt.Errorf("unable to render subject template: %w", err)
+	}
+	if err := n.body.Execute(&body, ev); err != nil {
+		return fmt.Errorf("unable to render body template: %w", err)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", n.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(n.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", strings.ReplaceAll(subject.String(), "\n", " ")))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body.String(), "\n", "\r\n"))
+
+	return n.send(msg.Bytes())
+}
+
+func (n *emailNotifier) send(msg []byte) error {
+	addr := net.JoinHostPort(n.host, n.port)
+	tlsConfig := &tls.Config{ServerName: n.host}
+
+	// Port 465 uses implicit TLS
+	var conn net.Conn
+	var err error
+	if n.port == "465" {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: 10 * time.Second}, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, 10*time.Second)
+	}
+	if err != nil {
+		return err
+	}
+
+	c, err := smtp.NewClient(conn, n.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	// PLAIN authentication is refused on unencrypted connections (except to
+	// localhost), so STARTTLS is also used with credentials when offered,
+	// even with SMTP_STARTTLS=false
+	if n.port != "465" {
+		offered, _ := c.Extension("STARTTLS")
+		if n.startTLS && !offered {
+			return fmt.Errorf("smtp server %s does not support STARTTLS", n.host)
+		}
+		if n.startTLS || offered && n.username != "" {
+			if err := c.StartTLS(tlsConfig); err != nil {
+				return fmt.Errorf("unable to start tls: %w", err)
+			}
+		}
+	}
+	if n.username != "" {
+		if err := c.Auth(smtp.PlainAuth("", n.username, n.password, n.host)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(n.from); err != nil {
+		return err
+	}
+	for _, addr := range n.to {
+		if err := c.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"flouret.io/update-route53/pkg/updater"
+	"github.com/aws/smithy-go"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Classes of update errors, reported in logs, the status and the
+// update_route53_errors_total metric
+const (
+	errorClassCheckIP            = "check_ip"
+	errorClassThrottled          = "throttled"
+	errorClassAccessDenied       = "access_denied"
+	errorClassPropagationTimeout = "propagation_timeout"
+	errorClassOther              = "other"
+)
+
+var (
+	errThrottled    = errors.New("throttled by aws")
+	errAccessDenied = errors.New("access denied by aws")
+)
+
+var updateErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "update_route53_errors_total",
+	Help: "Update errors, by class",
+}, []string{"class"})
+
+func init() {
+	prometheus.MustRegister(updateErrors)
+}
+
+// classifyError wraps errors returned by the AWS API in errThrottled or
+// errAccessDenied, based on their error code.
+func classifyError(err error) error {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+	switch apiErr.ErrorCode() {
+	case "Throttling", "ThrottlingException", "PriorRequestNotComplete", "RequestLimitExceeded", "TooManyRequestsException":
+		return fmt.Errorf("%w: %w", errThrottled, err)
+	case "AccessDenied", "AccessDeniedException", "UnauthorizedOperation", "InvalidClientTokenId", "SignatureDoesNotMatch", "ExpiredToken", "UnrecognizedClientException":
+		return fmt.Errorf("%w: %w", errAccessDenied, err)
+	}
+	return err
+}
+
+// errorClass returns the class of an update error.
+func errorClass(err error) string {
+	switch {
+	case errors.Is(err, updater.ErrCheckIP):
+		return errorClassCheckIP
+	case errors.Is(err, errThrottled):
+		return errorClassThrottled
+	case errors.Is(err, errAccessDenied):
+		return errorClassAccessDenied
+	case errors.Is(err, updater.ErrPropagationTimeout):
+		return errorClassPropagationTimeout
+	}
+	return errorClassOther
+}
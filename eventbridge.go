@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	ebtypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+)
+
+// Source of the custom events put on the EventBridge bus
+const eventBridgeSource = "update-route53"
+
+// eventBridgeNotifier puts change events on an EventBridge event bus.
+type eventBridgeNotifier struct {
+	svc      *eventbridge.Client
+	eventBus string
+}
+
+func (n *eventBridgeNotifier) name() string {
+	return "eventbridge"
+}
+
+func (n *eventBridgeNotifier) notify(ev event) error {
+	if ev.Type != eventChange {
+		return nil
+	}
+
+	detail, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	output, err := n.svc.PutEvents(context.TODO(), &eventbridge.PutEventsInput{
+		Entries: []ebtypes.PutEventsRequestEntry{{
+			EventBusName: aws.String(n.eventBus),
+			Source:       aws.String(eventBridgeSource),
+			DetailType:   aws.String("Record Changed"),
+			Detail:       aws.String(string(detail)),
+			Resources:    []string{"arn:aws:route53:::hostedzone/" + ev.HostedZoneId},
+			Time:         aws.Time(ev.Timestamp),
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	if output.FailedEntryCount > 0 {
+		return fmt.Errorf("unable to put event: %s", aws.ToString(output.Entries[0].ErrorMessage))
+	}
+	return nil
+}
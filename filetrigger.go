@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchTriggerFile triggers an update cycle whenever the given file is
+// created, written, or touched. The parent directory is watched so the file
+// does not need to exist in advance. It only returns on error.
+func watchTriggerFile(path string) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("unable to create watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	path = filepath.Clean(path)
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		return fmt.Errorf("unable to watch trigger file directory: %w", err)
+	}
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if filepath.Clean(event.Name) != path ||
+				!event.Has(fsnotify.Create|fsnotify.Write|fsnotify.Chmod) {
+				continue
+			}
+			logger.Info().Str("triggerFile", path).Msg("trigger file touched")
+			triggerUpdate()
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			return err
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// runHealthcheck queries the /healthz endpoint of a locally running instance
+// and returns the process exit code: 0 if healthy, 1 otherwise. It allows
+// Docker HEALTHCHECK directives to work without curl or wget in the image.
+func runHealthcheck(port uint64) int {
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	resp, err := client.Get(fmt.Sprintf("http://127.0.0.1:%d/healthz", port))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "healthcheck failed: %v\n", err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "healthcheck failed: %s\n", resp.Status)
+		return 1
+	}
+
+	return 0
+}
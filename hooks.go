@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// runHook runs a hook command with the given variables added to its
+// environment. The command is split on white space and run directly, without
+// a shell, so it also works in the scratch container image. Output is logged.
+func runHook(command string, vars map[string]string) error {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return errors.New("empty hook command")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = os.Environ()
+	for k, v := range vars {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+
+	output, err := cmd.CombinedOutput()
+	logger.Info().
+		Str("hook", command).
+		Str("output", strings.TrimSpace(string(output))).
+		Msg("hook finished")
+	if ctx.Err() != nil {
+		return fmt.Errorf("hook timed out after %s", hookTimeout)
+	}
+	return err
+}
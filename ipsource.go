@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"flouret.io/update-route53/pkg/ipsource"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	checkIPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "update_route53_check_ip_duration_seconds",
+		Help: "Latency of address detections, by source",
+	}, []string{"source"})
+	checkIPAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "update_route53_check_ip_attempts_total",
+		Help: "Address detection attempts, by source and result",
+	}, []string{"source", "result"})
+)
+
+func init() {
+	prometheus.MustRegister(checkIPDuration)
+	prometheus.MustRegister(checkIPAttempts)
+	ipsource.Observer = observeSource
+}
+
+// observeSource records the outcome of an attempt of a source in the
+// metrics.
+func observeSource(source ipsource.Source, latency time.Duration, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	checkIPDuration.WithLabelValues(source.String()).Observe(latency.Seconds())
+	checkIPAttempts.WithLabelValues(source.String(), result).Inc()
+}
+
+// detectSource returns the address detected from a source, retrying failed
+// detections. Failover sources observe and time out each of their sources
+// themselves, other sources are observed and timed out here.
+func detectSource(ctx context.Context, source ipsource.Source) (string, error) {
+	_, failover := source.(ipsource.Failover)
+	_, static := source.(ipsource.Static)
+	var address string
+	err := withRetries("detect address", func() error {
+		var err error
+		start := time.Now()
+		if failover {
+			address, err = source.Address(ctx)
+		} else {
+			address, err = ipsource.Attempt(ctx, source)
+		}
+		if !failover && !static {
+			observeSource(source, time.Since(start), err)
+		}
+		return err
+	})
+	return address, err
+}
+
+// parsePrefixLength parses the length of a delegated IPv6 prefix.
+func parsePrefixLength(s string) (int, error) {
+	bits, err := strconv.Atoi(s)
+	if err != nil || bits < 1 || bits > 127 {
+		return 0, fmt.Errorf("invalid prefix length %q", s)
+	}
+	return bits, nil
+}
+
+// parseSuffix validates the host part of an IPv6 address, such as
+// "::1a2b:3c4d:5e6f:7081", for prefix delegation.
+func parseSuffix(s string) (string, error) {
+	suffix, err := netip.ParseAddr(s)
+	if err != nil || !suffix.Is6() || suffix.Is4In6() {
+		return "", fmt.Errorf("invalid ipv6 suffix %q", s)
+	}
+	return suffix.String(), nil
+}
+
+// parseIID validates the derivation of an interface identifier, such as
+// "eui64:<mac>" or "stable:<secret>[@<mac>]".
+func parseIID(s string) (string, error) {
+	if _, err := ipsource.WithInterfaceID(netip.IPv6Unspecified(), s); err != nil {
+		return "", err
+	}
+	return s, nil
+}
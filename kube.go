@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Location of the in-cluster service account credentials
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount/"
+
+// kubeClient is a minimal client for the Kubernetes API server using the
+// in-cluster service account credentials.
+type kubeClient struct {
+	baseURL   string
+	namespace string
+	client    *http.Client
+}
+
+// kubeStatusError is returned when the API server responds with an error
+// status code.
+type kubeStatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *kubeStatusError) Error() string {
+	return fmt.Sprintf("kubernetes api error %d: %s", e.StatusCode, e.Message)
+}
+
+// isKubeStatus reports whether err is a kubeStatusError with the given code.
+func isKubeStatus(err error, code int) bool {
+	var statusErr *kubeStatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == code
+}
+
+func newInClusterKubeClient() (*kubeClient, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in a kubernetes cluster")
+	}
+
+	ca, err := os.ReadFile(serviceAccountDir + "ca.crt")
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("unable to parse service account ca certificate")
+	}
+
+	namespace, err := os.ReadFile(serviceAccountDir + "namespace")
+	if err != nil {
+		return nil, err
+	}
+
+	return &kubeClient{
+		baseURL:   "https://" + net.JoinHostPort(host, port),
+		namespace: strings.TrimSpace(string(namespace)),
+		client: &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{RootCAs: pool},
+			},
+		},
+	}, nil
+}
+
+// stream performs a request against the API server and returns the response
+// body on success. The caller must close the body.
+func (c *kubeClient) stream(ctx context.Context, method, path, contentType string, body any) (io.ReadCloser, error) {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	// Tokens are rotated by the kubelet, so read it on every request
+	token, err := os.ReadFile(serviceAccountDir + "token")
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		var status struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&status)
+		return nil, &kubeStatusError{StatusCode: resp.StatusCode, Message: status.Message}
+	}
+	return resp.Body, nil
+}
+
+// do performs a request against the API server and decodes the response into
+// out, if not nil.
+func (c *kubeClient) do(ctx context.Context, method, path, contentType string, body, out any) error {
+	respBody, err := c.stream(ctx, method, path, contentType, body)
+	if err != nil {
+		return err
+	}
+	defer respBody.Close()
+
+	if out == nil {
+		_, err = io.Copy(io.Discard, respBody)
+		return err
+	}
+	return json.NewDecoder(respBody).Decode(out)
+}
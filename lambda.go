@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+)
+
+// lambdaRuntimeAPIVersion is the version of the AWS Lambda runtime API used
+// to fetch invocations and report their results.
+const lambdaRuntimeAPIVersion = "2018-06-01"
+
+// runLambda acts as a custom AWS Lambda runtime: each invocation (typically
+// triggered by an EventBridge schedule) runs a single update cycle. It never
+// returns; errors talking to the runtime API are fatal.
+func runLambda(svc *route53.Client, records []record, runtimeAPI string) {
+	baseURL := fmt.Sprintf("http://%s/%s/runtime/invocation/", runtimeAPI, lambdaRuntimeAPIVersion)
+
+	logger.Info().Msg("running as aws lambda handler")
+
+	for {
+		// Block until the next invocation is available
+		resp, err := http.Get(baseURL + "next")
+		if err != nil {
+			logger.Fatal().Err(err).Msg("unable to fetch next lambda invocation")
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		requestId := resp.Header.Get("Lambda-Runtime-Aws-Request-Id")
+		logger := logger.With().Str("requestId", requestId).Logger()
+
+		start := time.Now()
+		err = updateRecordsRecovered(svc, records)
+		updateDuration.Add(float64(time.Since(start).Seconds()))
+
+		var url string
+		var payload []byte
+		if err == nil {
+			url = baseURL + requestId + "/response"
+			payload = []byte(`{"status":"ok"}`)
+		} else {
+			url = baseURL + requestId + "/error"
+			payload, _ = json.Marshal(map[string]string{
+				"errorMessage": err.Error(),
+				"errorType":    "UpdateFailed",
+			})
+		}
+
+		resp, err = http.Post(url, "application/json", bytes.NewReader(payload))
+		if err != nil {
+			logger.Fatal().Err(err).Msg("unable to report lambda invocation result")
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+}
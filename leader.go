@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Leader election timings, following the client-go defaults
+const (
+	leaseDuration = 15 * time.Second
+	leaseRetry    = 2 * time.Second
+)
+
+// Format of the MicroTime fields of a Lease
+const microTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+type lease struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name            string `json:"name"`
+		Namespace       string `json:"namespace"`
+		ResourceVersion string `json:"resourceVersion,omitempty"`
+	} `json:"metadata"`
+	Spec struct {
+		HolderIdentity       string `json:"holderIdentity,omitempty"`
+		LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+		AcquireTime          string `json:"acquireTime,omitempty"`
+		RenewTime            string `json:"renewTime,omitempty"`
+		LeaseTransitions     int    `json:"leaseTransitions"`
+	} `json:"spec"`
+}
+
+// leaderElector uses a Kubernetes Lease to elect a single active instance
+// among several replicas. Standby instances keep trying to acquire the lease
+// and take over once the leader stops renewing it.
+type leaderElector struct {
+	kube     *kubeClient
+	name     string
+	identity string
+	leader   atomic.Bool
+}
+
+func newLeaderElector(kube *kubeClient, name, identity string) *leaderElector {
+	return &leaderElector{kube: kube, name: name, identity: identity}
+}
+
+// isLeader reports whether this instance currently holds the lease.
+func (le *leaderElector) isLeader() bool {
+	return le.leader.Load()
+}
+
+// run acquires and renews the lease. It never returns.
+func (le *leaderElector) run() {
+	logger := logger.With().
+		Str("lease", le.name).
+		Str("identity", le.identity).
+		Logger()
+
+	for {
+		leader, err := le.tryAcquireOrRenew()
+		if err != nil {
+			logger.Err(err).Msg("unable to acquire or renew lease")
+		}
+
+		// Stop acting as leader if the lease could not be renewed
+		if le.leader.Swap(leader) != leader {
+			if leader {
+				logger.Info().Msg("acquired leadership")
+			} else {
+				logger.Warn().Msg("lost leadership")
+			}
+		}
+
+		time.Sleep(leaseRetry)
+	}
+}
+
+func (le *leaderElector) tryAcquireOrRenew() (bool, error) {
+	path := fmt.Sprintf("/apis/coordination.k8s.io/v1/namespaces/%s/leases", le.kube.namespace)
+	now := time.Now()
+
+	var l lease
+	err := le.kube.do(context.TODO(), http.MethodGet, path+"/"+le.name, "", nil, &l)
+	if isKubeStatus(err, http.StatusNotFound) {
+		// Create the lease, holding it
+		l.APIVersion = "coordination.k8s.io/v1"
+		l.Kind = "Lease"
+		l.Metadata.Name = le.name
+		l.Metadata.Namespace = le.kube.namespace
+		le.hold(&l, now)
+		err = le.kube.do(context.TODO(), http.MethodPost, path, "application/json", &l, nil)
+		if isKubeStatus(err, http.StatusConflict) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// Another instance holds an unexpired lease
+	if l.Spec.HolderIdentity != "" && l.Spec.HolderIdentity != le.identity {
+		renewTime, err := time.Parse(microTimeFormat, l.Spec.RenewTime)
+		expiry := renewTime.Add(time.Duration(l.Spec.LeaseDurationSeconds) * time.Second)
+		if err == nil && now.Before(expiry) {
+			return false, nil
+		}
+	}
+
+	// Take over or renew. The resourceVersion makes the update fail with a
+	// conflict if another instance updated the lease in the meantime.
+	le.hold(&l, now)
+	err = le.kube.do(context.TODO(), http.MethodPut, path+"/"+le.name, "application/json", &l, nil)
+	if isKubeStatus(err, http.StatusConflict) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// hold updates the lease spec to record this instance as the holder.
+func (le *leaderElector) hold(l *lease, now time.Time) {
+	if l.Spec.HolderIdentity != le.identity {
+		if l.Spec.HolderIdentity != "" {
+			l.Spec.LeaseTransitions++
+		}
+		l.Spec.HolderIdentity = le.identity
+		l.Spec.AcquireTime = now.UTC().Format(microTimeFormat)
+	}
+	l.Spec.LeaseDurationSeconds = int(leaseDuration.Seconds())
+	l.Spec.RenewTime = now.UTC().Format(microTimeFormat)
+}
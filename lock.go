@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// lockMargin is added to the longest time a lock may be held, so that locks
+// only expire when their holder died without releasing them.
+const lockMargin = 5 * time.Minute
+
+// lockTTL returns how long a lock is valid: the longest time it may be held,
+// through the pre-update hook, the propagation of the change and the
+// post-update hook, plus lockMargin.
+func lockTTL() time.Duration {
+	return propagationTimeout + 2*hookTimeout + lockMargin
+}
+
+// dynamoLock is a distributed lock stored in a DynamoDB table whose partition
+// key is the string attribute LockID. It prevents several instances from
+// changing the same record concurrently.
+type dynamoLock struct {
+	svc   *dynamodb.Client
+	table string
+	owner string
+}
+
+// errLocked is returned when the lock is held by another instance.
+var errLocked = errors.New("record is locked by another instance")
+
+// acquire takes the lock for the given key and returns a function that
+// releases it.
+func (l *dynamoLock) acquire(ctx context.Context, key string) (func(), error) {
+	now := time.Now()
+	_, err := l.svc.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(l.table),
+		Item: map[string]ddbtypes.AttributeValue{
+			"LockID":  &ddbtypes.AttributeValueMemberS{Value: key},
+			"Owner":   &ddbtypes.AttributeValueMemberS{Value: l.owner},
+			"Expires": &ddbtypes.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(lockTTL()).Unix(), 10)},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(LockID) OR Expires < :now OR #owner = :owner"),
+		ExpressionAttributeNames: map[string]string{
+			"#owner": "Owner",
+		},
+		ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{
+			":now":   &ddbtypes.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)},
+			":owner": &ddbtypes.AttributeValueMemberS{Value: l.owner},
+		},
+	})
+	var conditionErr *ddbtypes.ConditionalCheckFailedException
+	if errors.As(err, &conditionErr) {
+		return nil, errLocked
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to acquire lock: %w", err)
+	}
+
+	release := func() {
+		_, err := l.svc.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+			TableName: aws.String(l.table),
+			Key: map[string]ddbtypes.AttributeValue{
+				"LockID": &ddbtypes.AttributeValueMemberS{Value: key},
+			},
+			ConditionExpression: aws.String("#owner = :owner"),
+			ExpressionAttributeNames: map[string]string{
+				"#owner": "Owner",
+			},
+			ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{
+				":owner": &ddbtypes.AttributeValueMemberS{Value: l.owner},
+			},
+		})
+		if err != nil {
+			logger.Err(err).Str("lock", key).Msg("unable to release lock")
+		}
+	}
+	return release, nil
+}
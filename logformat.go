@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// Log output formats (LOG_FORMAT)
+const (
+	logFormatJSON       = "json"        // One JSON object per line
+	logFormatConsole    = "console"     // Human readable, colored
+	logFormatLogfmt     = "logfmt"      // key=value pairs
+	logFormatPrettyJSON = "pretty-json" // Indented JSON, for debugging
+)
+
+// logWriter returns a writer that formats the JSON logs of zerolog in the
+// given format.
+func logWriter(format string, out io.Writer) (io.Writer, error) {
+	switch format {
+	case logFormatJSON:
+		return out, nil
+	case logFormatConsole:
+		return zerolog.ConsoleWriter{Out: out}, nil
+	case logFormatLogfmt:
+		return logfmtWriter{out}, nil
+	case logFormatPrettyJSON:
+		return prettyJSONWriter{out}, nil
+	}
+	return nil, fmt.Errorf("unknown log format %q", format)
+}
+
+// logfmtWriter writes each log event as a line of key=value pairs, with the
+// time, level and message first.
+type logfmtWriter struct {
+	out io.Writer
+}
+
+func (w logfmtWriter) Write(p []byte) (int, error) {
+	decoder := json.NewDecoder(bytes.NewReader(p))
+	decoder.UseNumber()
+	var fields map[string]any
+	if err := decoder.Decode(&fields); err != nil {
+		return 0, err
+	}
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		switch key {
+		case zerolog.TimestampFieldName, zerolog.LevelFieldName, zerolog.MessageFieldName:
+		default:
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	keys = append([]string{zerolog.TimestampFieldName, zerolog.LevelFieldName, zerolog.MessageFieldName}, keys...)
+
+	var buf bytes.Buffer
+	for _, key := range keys {
+		value, ok := fields[key]
+		if !ok {
+			continue
+		}
+		if buf.Len() > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(key)
+		buf.WriteByte('=')
+		buf.WriteString(logfmtValue(value))
+	}
+	buf.WriteByte('\n')
+
+	if _, err := w.out.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// logfmtValue formats a value of a log field, quoting it if needed.
+func logfmtValue(value any) string {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	case nil:
+		return "null"
+	default:
+		data, _ := json.Marshal(v)
+		s = string(data)
+	}
+	if s == "" || strings.ContainsAny(s, " =\"\t\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// prettyJSONWriter writes each log event as indented JSON.
+type prettyJSONWriter struct {
+	out io.Writer
+}
+
+func (w prettyJSONWriter) Write(p []byte) (int, error) {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, bytes.TrimSpace(p), "", "  "); err != nil {
+		return 0, err
+	}
+	buf.WriteByte('\n')
+	if _, err := w.out.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// Log outputs (LOG_OUTPUT)
+const (
+	logOutputStdout   = "stdout"   // Standard output, in LOG_FORMAT
+	logOutputSyslog   = "syslog"   // Local syslog daemon, in LOG_FORMAT
+	logOutputJournald = "journald" // systemd journal, with structured fields
+)
+
+// syslogIdentifier tags the logs sent to syslog and journald.
+const syslogIdentifier = "update-route53"
+
+// journaldSocket is where journald receives native protocol messages.
+const journaldSocket = "/run/systemd/journal/socket"
+
+// newLogOutput returns a writer that sends the logs to the given output, in
+// the given format.
+func newLogOutput(output, format string) (io.Writer, error) {
+	switch output {
+	case logOutputStdout:
+		return logWriter(format, os.Stdout)
+	case logOutputSyslog:
+		return newSyslogWriter(format)
+	case logOutputJournald:
+		return newJournaldWriter()
+	}
+	return nil, fmt.Errorf("unknown log output %q", output)
+}
+
+// syslogPriority maps a log level to a syslog priority.
+func syslogPriority(level zerolog.Level) int {
+	switch level {
+	case zerolog.TraceLevel, zerolog.DebugLevel:
+		return 7 // LOG_DEBUG
+	case zerolog.WarnLevel:
+		return 4 // LOG_WARNING
+	case zerolog.ErrorLevel:
+		return 3 // LOG_ERR
+	case zerolog.FatalLevel:
+		return 2 // LOG_CRIT
+	case zerolog.PanicLevel:
+		return 0 // LOG_EMERG
+	}
+	return 6 // LOG_INFO
+}
+
+// journaldWriter sends log events to journald with its native protocol: the
+// message and priority, plus a journal field for each log field (dnsName is
+// sent as DNSNAME).
+type journaldWriter struct {
+	conn *net.UnixConn
+}
+
+// newJournaldWriter connects to the local journald socket.
+func newJournaldWriter() (*journaldWriter, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journaldSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &journaldWriter{conn: conn}, nil
+}
+
+func (w *journaldWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(zerolog.NoLevel, p)
+}
+
+func (w *journaldWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	decoder := json.NewDecoder(bytes.NewReader(p))
+	decoder.UseNumber()
+	var fields map[string]any
+	if err := decoder.Decode(&fields); err != nil {
+		return 0, err
+	}
+
+	var buf bytes.Buffer
+	writeJournalField(&buf, "PRIORITY", fmt.Sprint(syslogPriority(level)))
+	writeJournalField(&buf, "SYSLOG_IDENTIFIER", syslogIdentifier)
+	for key, value := range fields {
+		switch key {
+		case zerolog.LevelFieldName, zerolog.TimestampFieldName:
+			continue
+		case zerolog.MessageFieldName:
+			key = "MESSAGE"
+		default:
+			key = journalFieldName(key)
+		}
+		s, ok := value.(string)
+		if !ok {
+			data, _ := json.Marshal(value)
+			s = string(data)
+		}
+		writeJournalField(&buf, key, s)
+	}
+
+	if _, err := w.conn.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// journalFieldName converts a log field name to a valid journal field name:
+// upper case letters, digits and underscores, not starting with an
+// underscore or digit.
+func journalFieldName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, key)
+	name = strings.TrimLeft(name, "_")
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		name = "FIELD_" + name
+	}
+	return name
+}
+
+// writeJournalField appends a field in the journald native protocol format.
+// Values with newlines are sent with their length instead of a separator.
+func writeJournalField(buf *bytes.Buffer, name, value string) {
+	if !strings.Contains(value, "\n") {
+		fmt.Fprintf(buf, "%s=%s\n", name, value)
+		return
+	}
+	buf.WriteString(name)
+	buf.WriteByte('\n')
+	binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// lokiMaxBuffered is the number of log lines kept while Loki is unreachable.
+const lokiMaxBuffered = 50000
+
+// lokiWriter ships log lines to the push API of Grafana Loki. Lines are
+// buffered and pushed in batches every flush interval. Failed batches are
+// retried on the next flush, dropping the oldest lines if too many pile up.
+type lokiWriter struct {
+	url    string
+	labels map[string]string
+	client *http.Client
+
+	mu     sync.Mutex
+	values [][2]string // Timestamp in nanoseconds and line, guarded by mu
+
+	flushMu sync.Mutex // Serializes flushes
+}
+
+// lokiLogs ships logs to Loki, if LOKI_URL is set.
+var lokiLogs *lokiWriter
+
+// newLokiWriter returns a writer pushing to the given Loki push API URL with
+// the given stream labels, and starts flushing it at the given interval.
+func newLokiWriter(url string, labels map[string]string, interval time.Duration) *lokiWriter {
+	w := &lokiWriter{
+		url:    url,
+		labels: labels,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+	go func() {
+		for range time.Tick(interval) {
+			w.flush()
+		}
+	}()
+	return w
+}
+
+func (w *lokiWriter) Write(p []byte) (int, error) {
+	line := strings.TrimSuffix(string(p), "\n")
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.values = append(w.values, [2]string{strconv.FormatInt(time.Now().UnixNano(), 10), line})
+	if len(w.values) > lokiMaxBuffered {
+		w.values = w.values[len(w.values)-lokiMaxBuffered:]
+	}
+	return len(p), nil
+}
+
+// flush pushes the buffered lines. Errors are not logged, since that would
+// add more lines, and the lines are kept for the next flush.
+func (w *lokiWriter) flush() error {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+
+	// Push without holding mu, so logging does not block on the network
+	w.mu.Lock()
+	values := w.values
+	w.values = nil
+	w.mu.Unlock()
+	if len(values) == 0 {
+		return nil
+	}
+
+	err := w.push(values)
+	if err != nil {
+		w.mu.Lock()
+		w.values = append(values, w.values...)
+		if len(w.values) > lokiMaxBuffered {
+			w.values = w.values[len(w.values)-lokiMaxBuffered:]
+		}
+		w.mu.Unlock()
+	}
+	return err
+}
+
+// push sends lines to Loki as a single stream.
+func (w *lokiWriter) push(values [][2]string) error {
+	body, err := json.Marshal(map[string]any{
+		"streams": []map[string]any{{
+			"stream": w.labels,
+			"values": values,
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(context.TODO(), http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("loki returned %s", resp.Status)
+	}
+	return nil
+}
+
+// parseLokiLabels parses stream labels given as "name=value,..." into
+// labels, which already holds the defaults.
+func parseLokiLabels(s string, labels map[string]string) error {
+	for _, pair := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || name == "" {
+			return fmt.Errorf("invalid label %q", pair)
+		}
+		labels[name] = value
+	}
+	return nil
+}
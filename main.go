@@ -2,23 +2,34 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
-	"net/url"
 	"os"
 	"strconv"
 	"strings"
 	"time"
 
+	"flouret.io/update-route53/pkg/ipsource"
+	"flouret.io/update-route53/pkg/provider"
+	"flouret.io/update-route53/pkg/updater"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
 	"github.com/aws/aws-sdk-go-v2/service/route53"
 	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/robfig/cron/v3"
 	"github.com/rs/zerolog"
 )
 
@@ -32,184 +43,621 @@ var (
 	dnsTTL       = uint64(300)                     // DNS_TTL environment variable
 	hostedZoneId = ""                              // HOSTED_ZONE_ID environment variable
 	checkIPURL   = "http://checkip.amazonaws.com/" // CHECK_IP environment variable
+	staticIP     = ""                              // STATIC_IP environment variable
+	ifaceName    = ""                              // INTERFACE environment variable
+	privateZone  = false                           // PRIVATE_ZONE environment variable
+	allowBogon   = false                           // ALLOW_BOGON environment variable
 	sleepPeriod  = 5 * time.Minute                 // SLEEP_PERIOD environment variable
 
-	logger zerolog.Logger
+	routingPolicy = updater.RoutingSimple // ROUTING_POLICY environment variable
+	setIdentifier = ""                    // SET_IDENTIFIER environment variable
+	healthCheckId = ""                    // HEALTH_CHECK_ID environment variable
+	weight        = int64(-1)             // WEIGHT environment variable
+
+	ipv6Record        = false // RECORD_TYPE environment variable
+	ipv6PrefixLength  = 64    // IPV6_PREFIX_LENGTH environment variable
+	ipv6Suffix        = ""    // IPV6_SUFFIX environment variable
+	ipv6PrefixRewrite = false // IPV6_PREFIX_REWRITE environment variable
+	ipv6IID           = ""    // IPV6_IID environment variable
+
+	geoContinent   = "" // GEO_CONTINENT environment variable
+	geoCountry     = "" // GEO_COUNTRY environment variable
+	geoSubdivision = "" // GEO_SUBDIVISION environment variable
+	failover       = "" // FAILOVER environment variable
+
+	healthCheckType = ""  // HEALTH_CHECK_TYPE environment variable
+	healthCheckPort = 0   // HEALTH_CHECK_PORT environment variable
+	healthCheckPath = "/" // HEALTH_CHECK_PATH environment variable
+
+	schedule         cron.Schedule      // SCHEDULE environment variable
+	sleepJitter      = float64(0)       // SLEEP_JITTER environment variable
+	fastSleepPeriod  = time.Duration(0) // FAST_SLEEP_PERIOD environment variable
+	fastPeriodWindow = 30 * time.Minute // FAST_PERIOD_WINDOW environment variable
+
+	confirmations        = uint64(1)        // CONFIRMATIONS environment variable
+	confirmationInterval = 10 * time.Second // CONFIRMATION_INTERVAL environment variable
+
+	minChangeInterval = time.Duration(0) // MIN_CHANGE_INTERVAL environment variable
+
+	propagationTimeout = 10 * time.Minute // PROPAGATION_TIMEOUT environment variable
+	dnssecResolver     = ""               // DNSSEC_RESOLVER environment variable
+
+	retryAttempts = 3                // RETRY_ATTEMPTS environment variable
+	retryMaxDelay = 20 * time.Second // RETRY_MAX_DELAY environment variable
+
+	throttleBackoff    = 30 * time.Second // THROTTLE_BACKOFF environment variable
+	throttleMaxBackoff = 10 * time.Minute // THROTTLE_MAX_BACKOFF environment variable
+
+	route53DailyBudget = 0 // ROUTE53_DAILY_BUDGET environment variable
+
+	stateFile      = ""                // STATE_FILE environment variable
+	verifyInterval = time.Duration(0)  // VERIFY_INTERVAL environment variable
+	recordSource   = recordSourceAPI   // RECORD_SOURCE environment variable
+	multiValueMode = multiValueReplace // MULTI_VALUE_MODE environment variable
+	replaceAlias   = false             // REPLACE_ALIAS environment variable
+	metadataRecord = ""                // METADATA_RECORD environment variable
+	cnameTarget    = ""                // CNAME_TARGET environment variable
+
+	driftAction = updater.DriftReassert // DRIFT_ACTION environment variable
+
+	auditLogPath    = ""               // AUDIT_LOG environment variable
+	auditMaxEntries = 0                // AUDIT_LOG_MAX_ENTRIES environment variable
+	auditMaxAge     = time.Duration(0) // AUDIT_LOG_MAX_AGE environment variable
+
+	reverseHostedZoneId = "" // REVERSE_HOSTED_ZONE_ID environment variable
+
+	srvRecord   = ""        // SRV_RECORD environment variable
+	srvPriority = uint64(0) // SRV_PRIORITY environment variable
+	srvWeight   = uint64(0) // SRV_WEIGHT environment variable
+	srvPort     = uint64(0) // SRV_PORT environment variable
+	srvPortFile = ""        // SRV_PORT_FILE environment variable
+	srvTarget   = ""        // SRV_TARGET environment variable
+
+	watchIfaceName = "" // WATCH_INTERFACE environment variable
+	triggerFile    = "" // TRIGGER_FILE environment variable
+
+	mqttBroker       = "" // MQTT_BROKER environment variable
+	mqttTriggerTopic = "" // MQTT_TRIGGER_TOPIC environment variable
+	mqttPublishTopic = "" // MQTT_PUBLISH_TOPIC environment variable
+	mqttClient       mqtt.Client
+
+	failureThreshold       = uint64(3) // FAILURE_THRESHOLD environment variable
+	notifyReminderInterval = time.Hour // NOTIFY_REMINDER_INTERVAL environment variable
+
+	preUpdateHook  = ""          // PRE_UPDATE_HOOK environment variable
+	postUpdateHook = ""          // POST_UPDATE_HOOK environment variable
+	hookTimeout    = time.Minute // HOOK_TIMEOUT environment variable
+
+	privateHostedZoneId = ""        // PRIVATE_HOSTED_ZONE_ID environment variable
+	privateIfaceName    = ""        // PRIVATE_INTERFACE environment variable
+	privateDNSTTL       = uint64(0) // PRIVATE_DNS_TTL environment variable
+
+	extraRecords []record // RECORDS environment variable
+
+	locker *dynamoLock // LOCK_TABLE environment variable
+
+	ownerID        = ""    // OWNER_ID environment variable
+	forceOwnership = false // FORCE_OWNERSHIP environment variable
+
+	protectExisting = false // PROTECT_EXISTING environment variable
+	requireExisting = false // REQUIRE_EXISTING environment variable
+
+	onShutdown = shutdownActionNone // ON_SHUTDOWN environment variable
+	runFor     = time.Duration(0)   // RUN_FOR environment variable
+
+	serverPort  = uint64(8080) // PORT environment variable
+	adminSocket = ""           // ADMIN_SOCKET environment variable
+
+	cloudWatchLogGroup      = ""              // CLOUDWATCH_LOG_GROUP environment variable
+	cloudWatchLogStream     = ""              // CLOUDWATCH_LOG_STREAM environment variable
+	cloudWatchFlushInterval = 5 * time.Second // CLOUDWATCH_FLUSH_INTERVAL environment variable
+
+	lokiURL           = ""              // LOKI_URL environment variable
+	lokiLabels        map[string]string // LOKI_LABELS environment variable
+	lokiFlushInterval = 5 * time.Second // LOKI_FLUSH_INTERVAL environment variable
+
+	logger    zerolog.Logger
+	logLevel  = zerolog.InfoLevel // LOG_LEVEL environment variable
+	logFormat = logFormatJSON     // LOG_FORMAT environment variable
+	logOutput = logOutputStdout   // LOG_OUTPUT environment variable
+
+	unchangedLogEvery = uint64(1) // UNCHANGED_LOG_EVERY environment variable
 )
 
 func init() {
 	prometheus.MustRegister(updateDuration)
 }
 
-func updateRoute53(svc *route53.Client) {
+// Sources of the current value of a record (RECORD_SOURCE)
+const (
+	recordSourceAPI = "api" // Route53 ListResourceRecordSets
+	recordSourceDNS = "dns" // Query the authoritative nameservers
+)
 
-	logger := logger // local copy of logger
+// maxTTL is the largest TTL accepted by Route53.
+const maxTTL = 2147483647
 
-	// Fetch current IP address
-	resp, err := http.Get(checkIPURL)
+// parseTTL parses a TTL and checks it is within the limits of Route53.
+func parseTTL(s string) (uint64, error) {
+	ttl, err := strconv.ParseUint(s, 10, 64)
 	if err != nil {
-		logger.Err(err).Msg("unable to fetch current address")
-		return
+		return 0, err
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		logger.Err(err).Msg("unable to read response body")
-		return
+	if ttl > maxTTL {
+		return 0, fmt.Errorf("TTL %d is larger than %d", ttl, maxTTL)
 	}
+	return ttl, nil
+}
 
-	// Validate IP address
-	ipstr := strings.TrimSpace(string(body))
-	ip := net.ParseIP(ipstr)
-	if ip == nil {
-		logger.Error().
-			Str("address", ipstr).
-			Msg("unable to parse address")
-		return
-	}
+// record describes a DNS record maintained by update-route53.
+type record = updater.Record
 
-	logger = logger.With().Str("currentAddress", ipstr).Logger()
+// updateRoute53 runs a single update cycle for the given record. Failures are
+// logged and returned.
+func updateRoute53(svc *route53.Client, rec record) error {
+	return recordUpdater.Update(context.TODO(), []record{rec})[0]
+}
 
-	// Fetch current value of record in AWS Route53
-	currentRecordValue, currentRecordTTL, err := getCurrentRecordValue(svc)
-	if err != nil {
-		logger.Err(err).Msg("unable to get current record value")
-		return
-	}
-
-	logger = logger.With().
-		Str("currentRecordValue", currentRecordValue).
-		Uint64("currentRecordTTL", currentRecordTTL).Logger()
-
-	// Check if the current IP is different from the record value
-	if currentRecordValue == ipstr &&
-		currentRecordTTL == dnsTTL {
-		logger.Info().Msg("address has not changed")
-		return
-	}
-
-	// Update the record in AWS Route53
-	input := &route53.ChangeResourceRecordSetsInput{
-		ChangeBatch: &types.ChangeBatch{
-			Changes: []types.Change{
-				{
-					Action: types.ChangeActionUpsert,
-					ResourceRecordSet: &types.ResourceRecordSet{
-						Name:            aws.String(dnsName),
-						Type:            types.RRTypeA,
-						TTL:             aws.Int64(int64(dnsTTL)),
-						ResourceRecords: []types.ResourceRecord{{Value: aws.String(ipstr)}},
-					},
-				},
-			},
-		},
-		HostedZoneId: aws.String("/hostedzone/" + hostedZoneId),
-	}
-	changeOutput, err := svc.ChangeResourceRecordSets(context.TODO(), input)
-	if err != nil {
-		logger.Err(err).Msg("unable to change record sets")
-		return
-	}
+// updateRecords runs a single update cycle for each of the given records and
+// returns the errors of the records that failed.
+func updateRecords(svc *route53.Client, records []record) error {
+	// Tag the logs and changes of this cycle with a new id
+	startCycle()
+	defer endCycle()
 
-	logger = logger.With().Str("change", *changeOutput.ChangeInfo.Id).Logger()
-	logger.Info().Msg("change submitted")
+	// Back off after throttled cycles instead of adding to the throttling
+	if err := throttledCycle(); err != nil {
+		return err
+	}
 
-	// Wait until the changes are INSYNC
-	for {
-		resp, err := svc.GetChange(context.TODO(), &route53.GetChangeInput{
-			Id: aws.String(*changeOutput.ChangeInfo.Id),
-		})
+	var errs []error
+	throttled := false
+	for i, err := range recordUpdater.Update(context.TODO(), records) {
+		err = classifyError(err)
+		recordCycleResult(records[i], err)
 		if err != nil {
-			logger.Err(err).Msg("unable to get change status")
-			break
+			throttled = throttled || errors.Is(err, errThrottled)
+			class := errorClass(err)
+			updateErrors.WithLabelValues(class).Inc()
+			logger.Error().
+				Err(err).
+				Str("dnsName", provider.DisplayName(records[i].Name)).
+				Str("hostedZoneId", records[i].HostedZoneId).
+				Str("errorClass", class).
+				Msg("update failed")
+			addRecentError(records[i], err)
+			errs = append(errs, fmt.Errorf("%s: %w", records[i].Name, err))
 		}
+	}
 
-		if resp.ChangeInfo.Status == types.ChangeStatusInsync {
-
-			// Fetch current value of record again to confirm the change
-			updatedRecordValue, updatedRecordTTL, err := getCurrentRecordValue(svc)
-			if err != nil {
-				logger.Err(err).Msg("unable to get updated record value")
-				return
-			}
-
-			logger.Info().
-				Str("updatedRecordValue", updatedRecordValue).
-				Uint64("updatedRecordTTL", updatedRecordTTL).
-				Msg("change propagated")
-			break
+	if srvRecord != "" {
+		if err := updateSRVRecord(svc); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", srvRecord, err))
 		}
-
-		// Wait 10 seconds before checking again
-		time.Sleep(10 * time.Second)
 	}
-}
+	recordThrottle(throttled)
 
-func getCurrentRecordValue(svc *route53.Client) (string, uint64, error) {
-	listInput := &route53.ListResourceRecordSetsInput{
-		HostedZoneId: aws.String("/hostedzone/" + hostedZoneId),
-	}
-	listOutput, err := svc.ListResourceRecordSets(context.TODO(), listInput)
-	if err != nil {
-		return "", 0, err
-	}
-	var currentRecordValue string
-	var currentRecordTTL uint64
-	for _, recordSet := range listOutput.ResourceRecordSets {
-		if *recordSet.Name == (dnsName+".") && recordSet.Type == types.RRTypeA {
-			currentRecordValue = *recordSet.ResourceRecords[0].Value
-			currentRecordTTL = uint64(*recordSet.TTL)
-			break
+	// Persist the state, if enabled
+	if stateFile != "" {
+		if err := saveState(stateFile); err != nil {
+			logger.Err(err).Str("stateFile", stateFile).Msg("unable to save state")
 		}
 	}
-	return currentRecordValue, currentRecordTTL, nil
+	return errors.Join(errs...)
+}
+
+// getRecordSet returns the record set of the given record, or nil if it
+// does not exist.
+func getRecordSet(svc *route53.Client, rec record) (*types.ResourceRecordSet, error) {
+	return provider.New(svc).RecordSet(context.TODO(), rec.HostedZoneId, rec.Name, rec.RecordType(), rec.SetIdentifier)
 }
 
 func main() {
 	var err error
 
 	console := flag.Bool("console", false, "enable console logging")
-	port := flag.Uint("port", 8080, "port for health check/metrics server")
+	operator := flag.Bool("operator", false, "run as a kubernetes controller for DNSRecord resources")
+	leaderElect := flag.Bool("leader-elect", false, "use a kubernetes lease so only one replica performs updates")
+	showVersion := flag.Bool("version", false, "print the version and exit")
+	envFile := flag.String("env-file", "", "load environment variables from a dotenv file")
+	force := flag.Bool("force", false, "modify records with values this instance never wrote, with PROTECT_EXISTING")
+	registerConfigFlags(flag.CommandLine)
 	flag.Parse()
 
-	if *console {
-		logger = zerolog.New(zerolog.ConsoleWriter{Out: os.Stdout}).With().Timestamp().Logger()
+	// Load the dotenv file, if any, without overriding the environment
+	if *envFile != "" {
+		if err := loadEnvFile(*envFile); err != nil {
+			fmt.Fprintf(os.Stderr, "unable to load env file: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	// Read options from files, e.g. docker secrets
+	if err := loadFileOptions(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	// Flags take precedence over environment variables
+	if err := applyConfigFlags(flag.CommandLine); err != nil {
+		fmt.Fprintf(os.Stderr, "unable to apply flags: %v\n", err)
+		os.Exit(2)
+	}
+
+	if *showVersion {
+		printVersion(os.Stdout)
+		os.Exit(0)
+	}
+
+	// The port is parsed before the commands, which query the running instance
+	if portStr := os.Getenv("PORT"); portStr != "" {
+		serverPort, err = strconv.ParseUint(portStr, 10, 16)
+		if err != nil || serverPort == 0 {
+			fmt.Fprintln(os.Stderr, "invalid PORT environment variable")
+			os.Exit(2)
+		}
+	}
+
+	// Commands run once the configuration is parsed, instead of the main loop
+	var command string
+	var checkAWS *bool
+	var setAddress string
+	switch flag.Arg(0) {
+	case "":
+	case "healthcheck":
+		os.Exit(runHealthcheck(serverPort))
+	case "version":
+		printVersion(os.Stdout)
+		os.Exit(0)
+	case "status":
+		os.Exit(runStatus(serverPort, os.Getenv("ADMIN_SOCKET")))
+	case "config":
+		switch flag.Arg(1) {
+		case "init":
+			printSampleConfig(os.Stdout)
+			os.Exit(0)
+		case "validate":
+			command = "config validate"
+			configFlags := flag.NewFlagSet(command, flag.ExitOnError)
+			checkAWS = configFlags.Bool("aws", false, "check access to the hosted zones and records")
+			configFlags.Parse(flag.Args()[2:])
+		default:
+			fmt.Fprintf(os.Stderr, "unknown config command %q\n", flag.Arg(1))
+			os.Exit(2)
+		}
+	case "get", "delete", "hook":
+		command = flag.Arg(0)
+	case "history":
+		if flag.Arg(1) != "prune" {
+			fmt.Fprintf(os.Stderr, "unknown history command %q\n", flag.Arg(1))
+			os.Exit(2)
+		}
+		command = "history prune"
+	case "set":
+		command = flag.Arg(0)
+		setAddress = flag.Arg(1)
+		if net.ParseIP(setAddress) == nil {
+			fmt.Fprintln(os.Stderr, "usage: update-route53 set <address>")
+			os.Exit(2)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", flag.Arg(0))
+		os.Exit(2)
+	}
+
+	// Resolve values stored in SSM Parameter Store or Secrets Manager, once
+	// the commands that do not use the configuration have run
+	ctx, cancel := context.WithTimeout(context.Background(), referenceTimeout)
+	err = resolveConfigReferences(ctx)
+	cancel()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	var logOut io.Writer
+	if command != "" {
+		// Keep stdout for the command output, and only report problems
+		logger = zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr}).Level(zerolog.WarnLevel).With().Timestamp().Logger()
 	} else {
+		if logFormatStr := os.Getenv("LOG_FORMAT"); logFormatStr != "" {
+			logFormat = logFormatStr
+		}
+		if *console {
+			logFormat = logFormatConsole
+		}
+		if logOutputStr := os.Getenv("LOG_OUTPUT"); logOutputStr != "" {
+			logOutput = logOutputStr
+		}
 		logger = zerolog.New(os.Stdout).With().Timestamp().Logger()
+		if _, err := logWriter(logFormat, os.Stdout); err != nil {
+			logger.Fatal().Msg("invalid LOG_FORMAT environment variable")
+		}
+		logOut, err = newLogOutput(logOutput, logFormat)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("invalid LOG_OUTPUT environment variable")
+		}
+		logger = zerolog.New(logOut).With().Timestamp().Logger()
 	}
 
-	if *port < 1 || *port > 65535 {
-		logger.Fatal().Msg("invalid port number")
+	if logLevelStr := os.Getenv("LOG_LEVEL"); logLevelStr != "" {
+		logLevel, err = zerolog.ParseLevel(strings.ToLower(logLevelStr))
+		if err != nil {
+			logger.Fatal().Msg("invalid LOG_LEVEL environment variable")
+		}
+	}
+	zerolog.SetGlobalLevel(logLevel)
+
+	// Tag the logs of each update cycle with its id
+	logger = logger.Hook(cycleHook{})
+
+	if unchangedLogEveryStr := os.Getenv("UNCHANGED_LOG_EVERY"); unchangedLogEveryStr != "" {
+		unchangedLogEvery, err = strconv.ParseUint(unchangedLogEveryStr, 10, 64)
+		if err != nil {
+			logger.Fatal().Msg("invalid UNCHANGED_LOG_EVERY environment variable")
+		}
 	}
 
 	dnsName = os.Getenv("DNS_NAME")
-	if dnsName == "" {
+	if dnsName == "" && !*operator {
 		logger.Fatal().Msg("missing DNS_NAME environment variable")
 	}
+	if dnsName != "" {
+		dnsName, err = provider.NormalizeName(dnsName)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("invalid DNS_NAME environment variable")
+		}
+	}
 
 	dnsTTLStr := os.Getenv("DNS_TTL")
 	if dnsTTLStr != "" {
-		dnsTTL, err = strconv.ParseUint(dnsTTLStr, 10, 32)
+		dnsTTL, err = parseTTL(dnsTTLStr)
 		if err != nil {
 			logger.Fatal().Msg("invalid DNS_TTL environment variable")
 		}
 	}
 
 	hostedZoneId = os.Getenv("HOSTED_ZONE_ID")
-	if hostedZoneId == "" {
+	if hostedZoneId == "" && !*operator {
 		logger.Fatal().Msg("missing HOSTED_ZONE_ID environment variable")
 	}
 
 	tmpCheckIPURL := os.Getenv("CHECK_IP")
 	if tmpCheckIPURL != "" {
-		_, err := url.Parse(tmpCheckIPURL)
-		if err != nil {
-			logger.Fatal().Msg("invalid CHECK_IP environment variable")
+		if _, err := ipsource.Parse(tmpCheckIPURL); err != nil {
+			logger.Fatal().Err(err).Msg("invalid CHECK_IP environment variable")
 		}
 		checkIPURL = tmpCheckIPURL
 	}
 
+	staticIP = os.Getenv("STATIC_IP")
+	if staticIP != "" && net.ParseIP(staticIP) == nil {
+		logger.Fatal().Msg("invalid STATIC_IP environment variable")
+	}
+
+	ifaceName = os.Getenv("INTERFACE")
+
+	if recordTypeStr := os.Getenv("RECORD_TYPE"); recordTypeStr != "" {
+		if recordTypeStr != "A" && recordTypeStr != "AAAA" {
+			logger.Fatal().Msg("invalid RECORD_TYPE environment variable")
+		}
+		ipv6Record = recordTypeStr == "AAAA"
+	}
+	if prefixLengthStr := os.Getenv("IPV6_PREFIX_LENGTH"); prefixLengthStr != "" {
+		ipv6PrefixLength, err = parsePrefixLength(prefixLengthStr)
+		if err != nil {
+			logger.Fatal().Msg("invalid IPV6_PREFIX_LENGTH environment variable")
+		}
+	}
+	if suffixStr := os.Getenv("IPV6_SUFFIX"); suffixStr != "" {
+		ipv6Suffix, err = parseSuffix(suffixStr)
+		if err != nil {
+			logger.Fatal().Msg("invalid IPV6_SUFFIX environment variable")
+		}
+		if os.Getenv("RECORD_TYPE") == "A" {
+			logger.Fatal().Msg("IPV6_SUFFIX cannot be used with RECORD_TYPE=A")
+		}
+		ipv6Record = true
+	}
+	if iidStr := os.Getenv("IPV6_IID"); iidStr != "" {
+		ipv6IID, err = parseIID(iidStr)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("invalid IPV6_IID environment variable")
+		}
+		if os.Getenv("RECORD_TYPE") == "A" {
+			logger.Fatal().Msg("IPV6_IID cannot be used with RECORD_TYPE=A")
+		}
+		ipv6Record = true
+	}
+	if prefixRewriteStr := os.Getenv("IPV6_PREFIX_REWRITE"); prefixRewriteStr != "" {
+		ipv6PrefixRewrite, err = strconv.ParseBool(prefixRewriteStr)
+		if err != nil {
+			logger.Fatal().Msg("invalid IPV6_PREFIX_REWRITE environment variable")
+		}
+	}
+
+	privateZoneStr := os.Getenv("PRIVATE_ZONE")
+	if privateZoneStr != "" {
+		privateZone, err = strconv.ParseBool(privateZoneStr)
+		if err != nil {
+			logger.Fatal().Msg("invalid PRIVATE_ZONE environment variable")
+		}
+	}
+
+	allowBogonStr := os.Getenv("ALLOW_BOGON")
+	if allowBogonStr != "" {
+		allowBogon, err = strconv.ParseBool(allowBogonStr)
+		if err != nil {
+			logger.Fatal().Msg("invalid ALLOW_BOGON environment variable")
+		}
+	}
+
+	if routingPolicyStr := os.Getenv("ROUTING_POLICY"); routingPolicyStr != "" {
+		routingPolicy = routingPolicyStr
+		switch routingPolicy {
+		case updater.RoutingSimple, updater.RoutingMultivalue, updater.RoutingWeighted, updater.RoutingGeo, updater.RoutingFailover:
+		default:
+			logger.Fatal().Msg("invalid ROUTING_POLICY environment variable")
+		}
+	}
+
+	setIdentifier = os.Getenv("SET_IDENTIFIER")
+	if routingPolicy != updater.RoutingSimple && setIdentifier == "" {
+		setIdentifier, err = os.Hostname()
+		if err != nil {
+			logger.Fatal().Msg("missing SET_IDENTIFIER environment variable")
+		}
+	}
+	if routingPolicy == updater.RoutingSimple && setIdentifier != "" {
+		logger.Fatal().Msg("SET_IDENTIFIER requires a ROUTING_POLICY")
+	}
+
+	healthCheckId = os.Getenv("HEALTH_CHECK_ID")
+
+	weightStr := os.Getenv("WEIGHT")
+	if weightStr != "" {
+		weight, err = strconv.ParseInt(weightStr, 10, 64)
+		if err != nil || weight < 0 || weight > 255 {
+			logger.Fatal().Msg("invalid WEIGHT environment variable")
+		}
+	}
+	if routingPolicy == updater.RoutingWeighted && weight < 0 {
+		logger.Fatal().Msg("missing WEIGHT environment variable")
+	}
+
+	geoContinent = os.Getenv("GEO_CONTINENT")
+	geoCountry = os.Getenv("GEO_COUNTRY")
+	geoSubdivision = os.Getenv("GEO_SUBDIVISION")
+	if routingPolicy == updater.RoutingGeo {
+		if geoContinent == "" && geoCountry == "" {
+			logger.Fatal().Msg("missing GEO_CONTINENT or GEO_COUNTRY environment variable")
+		}
+		if geoContinent != "" && geoCountry != "" {
+			logger.Fatal().Msg("GEO_CONTINENT and GEO_COUNTRY are mutually exclusive")
+		}
+		if geoSubdivision != "" && geoCountry == "" {
+			logger.Fatal().Msg("GEO_SUBDIVISION requires GEO_COUNTRY")
+		}
+	}
+
+	healthCheckType = strings.ToUpper(os.Getenv("HEALTH_CHECK_TYPE"))
+	switch types.HealthCheckType(healthCheckType) {
+	case "":
+	case types.HealthCheckTypeHttp, types.HealthCheckTypeTcp:
+		healthCheckPort = 80
+	case types.HealthCheckTypeHttps:
+		healthCheckPort = 443
+	default:
+		logger.Fatal().Msg("invalid HEALTH_CHECK_TYPE environment variable")
+	}
+	if healthCheckType != "" && healthCheckId != "" {
+		logger.Fatal().Msg("HEALTH_CHECK_TYPE and HEALTH_CHECK_ID are mutually exclusive")
+	}
+
+	healthCheckPortStr := os.Getenv("HEALTH_CHECK_PORT")
+	if healthCheckPortStr != "" {
+		healthCheckPort, err = strconv.Atoi(healthCheckPortStr)
+		if err != nil || healthCheckPort < 1 || healthCheckPort > 65535 {
+			logger.Fatal().Msg("invalid HEALTH_CHECK_PORT environment variable")
+		}
+	}
+
+	if healthCheckPathStr := os.Getenv("HEALTH_CHECK_PATH"); healthCheckPathStr != "" {
+		healthCheckPath = healthCheckPathStr
+		if !strings.HasPrefix(healthCheckPath, "/") {
+			logger.Fatal().Msg("invalid HEALTH_CHECK_PATH environment variable")
+		}
+	}
+
+	failover = strings.ToUpper(os.Getenv("FAILOVER"))
+	if routingPolicy == updater.RoutingFailover {
+		switch types.ResourceRecordSetFailover(failover) {
+		case types.ResourceRecordSetFailoverPrimary:
+			if healthCheckId == "" && healthCheckType == "" {
+				logger.Warn().Msg("primary failover record without a health check will never fail over")
+			}
+		case types.ResourceRecordSetFailoverSecondary:
+		default:
+			logger.Fatal().Msg("invalid FAILOVER environment variable")
+		}
+	}
+
+	watchIfaceName = os.Getenv("WATCH_INTERFACE")
+	triggerFile = os.Getenv("TRIGGER_FILE")
+
+	mqttBroker = os.Getenv("MQTT_BROKER")
+	mqttTriggerTopic = os.Getenv("MQTT_TRIGGER_TOPIC")
+	mqttPublishTopic = os.Getenv("MQTT_PUBLISH_TOPIC")
+	if (mqttTriggerTopic != "" || mqttPublishTopic != "") && mqttBroker == "" {
+		logger.Fatal().Msg("missing MQTT_BROKER environment variable")
+	}
+
+	privateHostedZoneId = os.Getenv("PRIVATE_HOSTED_ZONE_ID")
+	privateIfaceName = os.Getenv("PRIVATE_INTERFACE")
+	if privateHostedZoneId != "" && privateIfaceName == "" {
+		logger.Fatal().Msg("missing PRIVATE_INTERFACE environment variable")
+	}
+
+	extraRecords, err = parseRecords(os.Getenv("RECORDS"), record{
+		HostedZoneId: hostedZoneId,
+		TTL:          dnsTTL,
+		CheckIPURL:   checkIPURL,
+		PrefixLength: ipv6PrefixLength,
+	})
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid RECORDS environment variable")
+	}
+
+	privateDNSTTL = dnsTTL
+	privateDNSTTLStr := os.Getenv("PRIVATE_DNS_TTL")
+	if privateDNSTTLStr != "" {
+		privateDNSTTL, err = parseTTL(privateDNSTTLStr)
+		if err != nil {
+			logger.Fatal().Msg("invalid PRIVATE_DNS_TTL environment variable")
+		}
+	}
+
+	ownerID = os.Getenv("OWNER_ID")
+
+	forceOwnershipStr := os.Getenv("FORCE_OWNERSHIP")
+	if forceOwnershipStr != "" {
+		forceOwnership, err = strconv.ParseBool(forceOwnershipStr)
+		if err != nil {
+			logger.Fatal().Msg("invalid FORCE_OWNERSHIP environment variable")
+		}
+	}
+
+	if protectExistingStr := os.Getenv("PROTECT_EXISTING"); protectExistingStr != "" {
+		protectExisting, err = strconv.ParseBool(protectExistingStr)
+		if err != nil {
+			logger.Fatal().Msg("invalid PROTECT_EXISTING environment variable")
+		}
+	}
+
+	if requireExistingStr := os.Getenv("REQUIRE_EXISTING"); requireExistingStr != "" {
+		requireExisting, err = strconv.ParseBool(requireExistingStr)
+		if err != nil {
+			logger.Fatal().Msg("invalid REQUIRE_EXISTING environment variable")
+		}
+	}
+
+	onShutdown = os.Getenv("ON_SHUTDOWN")
+	switch onShutdown {
+	case shutdownActionNone, shutdownActionDelete, shutdownActionRevert:
+	default:
+		logger.Fatal().Msg("invalid ON_SHUTDOWN environment variable")
+	}
+	if onShutdown == shutdownActionDelete && requireExisting {
+		logger.Fatal().Msg("ON_SHUTDOWN=delete cannot be used with REQUIRE_EXISTING")
+	}
+
+	if runForStr := os.Getenv("RUN_FOR"); runForStr != "" {
+		runFor, err = time.ParseDuration(runForStr)
+		if err != nil || runFor < 0 {
+			logger.Fatal().Msg("invalid RUN_FOR environment variable")
+		}
+	}
+
 	sleepPeriodStr := os.Getenv("SLEEP_PERIOD")
 	if sleepPeriodStr != "" {
 		sleepPeriod, err = time.ParseDuration(sleepPeriodStr)
@@ -218,20 +666,452 @@ func main() {
 		}
 	}
 
-	logger = logger.With().
-		Str("dnsName", dnsName).
-		Str("hostedZoneId", hostedZoneId).
-		Logger()
+	scheduleStr := os.Getenv("SCHEDULE")
+	if scheduleStr != "" {
+		schedule, err = cronParser.Parse(scheduleStr)
+		if err != nil {
+			logger.Fatal().Msg("invalid SCHEDULE environment variable")
+		}
+	}
+
+	sleepJitterStr := os.Getenv("SLEEP_JITTER")
+	if sleepJitterStr != "" {
+		sleepJitter, err = strconv.ParseFloat(sleepJitterStr, 64)
+		if err != nil || sleepJitter < 0 || sleepJitter >= 1 {
+			logger.Fatal().Msg("invalid SLEEP_JITTER environment variable")
+		}
+	}
+
+	fastSleepPeriodStr := os.Getenv("FAST_SLEEP_PERIOD")
+	if fastSleepPeriodStr != "" {
+		fastSleepPeriod, err = time.ParseDuration(fastSleepPeriodStr)
+		if err != nil {
+			logger.Fatal().Msg("invalid FAST_SLEEP_PERIOD environment variable")
+		}
+	}
+
+	fastPeriodWindowStr := os.Getenv("FAST_PERIOD_WINDOW")
+	if fastPeriodWindowStr != "" {
+		fastPeriodWindow, err = time.ParseDuration(fastPeriodWindowStr)
+		if err != nil {
+			logger.Fatal().Msg("invalid FAST_PERIOD_WINDOW environment variable")
+		}
+	}
+
+	confirmationsStr := os.Getenv("CONFIRMATIONS")
+	if confirmationsStr != "" {
+		confirmations, err = strconv.ParseUint(confirmationsStr, 10, 32)
+		if err != nil || confirmations < 1 {
+			logger.Fatal().Msg("invalid CONFIRMATIONS environment variable")
+		}
+	}
+
+	confirmationIntervalStr := os.Getenv("CONFIRMATION_INTERVAL")
+	if confirmationIntervalStr != "" {
+		confirmationInterval, err = time.ParseDuration(confirmationIntervalStr)
+		if err != nil {
+			logger.Fatal().Msg("invalid CONFIRMATION_INTERVAL environment variable")
+		}
+	}
+
+	minChangeIntervalStr := os.Getenv("MIN_CHANGE_INTERVAL")
+	if minChangeIntervalStr != "" {
+		minChangeInterval, err = time.ParseDuration(minChangeIntervalStr)
+		if err != nil {
+			logger.Fatal().Msg("invalid MIN_CHANGE_INTERVAL environment variable")
+		}
+	}
+
+	if propagationTimeoutStr := os.Getenv("PROPAGATION_TIMEOUT"); propagationTimeoutStr != "" {
+		propagationTimeout, err = time.ParseDuration(propagationTimeoutStr)
+		if err != nil || propagationTimeout <= 0 {
+			logger.Fatal().Msg("invalid PROPAGATION_TIMEOUT environment variable")
+		}
+	}
+
+	if dnssecResolverStr := os.Getenv("DNSSEC_RESOLVER"); dnssecResolverStr != "" {
+		dnssecResolver, err = parseResolver(dnssecResolverStr)
+		if err != nil {
+			logger.Fatal().Msg("invalid DNSSEC_RESOLVER environment variable")
+		}
+	}
+
+	if retryAttemptsStr := os.Getenv("RETRY_ATTEMPTS"); retryAttemptsStr != "" {
+		retryAttempts, err = strconv.Atoi(retryAttemptsStr)
+		if err != nil || retryAttempts < 1 {
+			logger.Fatal().Msg("invalid RETRY_ATTEMPTS environment variable")
+		}
+	}
+	if retryMaxDelayStr := os.Getenv("RETRY_MAX_DELAY"); retryMaxDelayStr != "" {
+		retryMaxDelay, err = time.ParseDuration(retryMaxDelayStr)
+		if err != nil || retryMaxDelay <= 0 {
+			logger.Fatal().Msg("invalid RETRY_MAX_DELAY environment variable")
+		}
+	}
+	if throttleBackoffStr := os.Getenv("THROTTLE_BACKOFF"); throttleBackoffStr != "" {
+		throttleBackoff, err = time.ParseDuration(throttleBackoffStr)
+		if err != nil || throttleBackoff <= 0 {
+			logger.Fatal().Msg("invalid THROTTLE_BACKOFF environment variable")
+		}
+	}
+	if throttleMaxBackoffStr := os.Getenv("THROTTLE_MAX_BACKOFF"); throttleMaxBackoffStr != "" {
+		throttleMaxBackoff, err = time.ParseDuration(throttleMaxBackoffStr)
+		if err != nil || throttleMaxBackoff < throttleBackoff {
+			logger.Fatal().Msg("invalid THROTTLE_MAX_BACKOFF environment variable")
+		}
+	}
+
+	failureThresholdStr := os.Getenv("FAILURE_THRESHOLD")
+	if failureThresholdStr != "" {
+		failureThreshold, err = strconv.ParseUint(failureThresholdStr, 10, 32)
+		if err != nil || failureThreshold < 1 {
+			logger.Fatal().Msg("invalid FAILURE_THRESHOLD environment variable")
+		}
+	}
+
+	notifyReminderIntervalStr := os.Getenv("NOTIFY_REMINDER_INTERVAL")
+	if notifyReminderIntervalStr != "" {
+		notifyReminderInterval, err = time.ParseDuration(notifyReminderIntervalStr)
+		if err != nil {
+			logger.Fatal().Msg("invalid NOTIFY_REMINDER_INTERVAL environment variable")
+		}
+	}
+
+	if changeTemplate := os.Getenv("NOTIFY_CHANGE_TEMPLATE"); changeTemplate != "" {
+		if err := parseMessageTemplate(eventChange, changeTemplate); err != nil {
+			logger.Fatal().Err(err).Msg("invalid NOTIFY_CHANGE_TEMPLATE environment variable")
+		}
+	}
+
+	if failureTemplate := os.Getenv("NOTIFY_FAILURE_TEMPLATE"); failureTemplate != "" {
+		if err := parseMessageTemplate(eventFailure, failureTemplate); err != nil {
+			logger.Fatal().Err(err).Msg("invalid NOTIFY_FAILURE_TEMPLATE environment variable")
+		}
+	}
+
+	if recoveryTemplate := os.Getenv("NOTIFY_RECOVERY_TEMPLATE"); recoveryTemplate != "" {
+		if err := parseMessageTemplate(eventRecovery, recoveryTemplate); err != nil {
+			logger.Fatal().Err(err).Msg("invalid NOTIFY_RECOVERY_TEMPLATE environment variable")
+		}
+	}
+
+	if webhookURL := os.Getenv("WEBHOOK_URL"); webhookURL != "" {
+		retries := 3
+		if retriesStr := os.Getenv("WEBHOOK_RETRIES"); retriesStr != "" {
+			retries, err = strconv.Atoi(retriesStr)
+			if err != nil || retries < 0 {
+				logger.Fatal().Msg("invalid WEBHOOK_RETRIES environment variable")
+			}
+		}
+		webhook, err := newWebhookNotifier(webhookURL,
+			os.Getenv("WEBHOOK_TEMPLATE"), os.Getenv("WEBHOOK_SECRET"), retries)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("invalid WEBHOOK_TEMPLATE environment variable")
+		}
+		notifiers = append(notifiers, webhook)
+	}
+
+	if slackURL := os.Getenv("SLACK_WEBHOOK_URL"); slackURL != "" {
+		notifiers = append(notifiers, newSlackNotifier(slackURL,
+			os.Getenv("SLACK_CHANNEL"), os.Getenv("SLACK_USERNAME")))
+	}
+
+	if discordURL := os.Getenv("DISCORD_WEBHOOK_URL"); discordURL != "" {
+		notifiers = append(notifiers, newDiscordNotifier(discordURL, os.Getenv("DISCORD_USERNAME")))
+	}
+
+	if smtpHost := os.Getenv("SMTP_HOST"); smtpHost != "" {
+		smtpPort := os.Getenv("SMTP_PORT")
+		if smtpPort == "" {
+			smtpPort = "587"
+		}
+		smtpStartTLS := true
+		if smtpStartTLSStr := os.Getenv("SMTP_STARTTLS"); smtpStartTLSStr != "" {
+			smtpStartTLS, err = strconv.ParseBool(smtpStartTLSStr)
+			if err != nil {
+				logger.Fatal().Msg("invalid SMTP_STARTTLS environment variable")
+			}
+		}
+		if os.Getenv("SMTP_FROM") == "" || os.Getenv("SMTP_TO") == "" {
+			logger.Fatal().Msg("missing SMTP_FROM or SMTP_TO environment variable")
+		}
+		email, err := newEmailNotifier(smtpHost, smtpPort,
+			os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"),
+			os.Getenv("SMTP_FROM"), os.Getenv("SMTP_TO"), smtpStartTLS,
+			os.Getenv("SMTP_SUBJECT_TEMPLATE"), os.Getenv("SMTP_BODY_TEMPLATE"))
+		if err != nil {
+			logger.Fatal().Err(err).Msg("invalid SMTP template environment variable")
+		}
+		notifiers = append(notifiers, email)
+	}
+
+	if ntfyURL := os.Getenv("NTFY_URL"); ntfyURL != "" {
+		failurePriority := os.Getenv("NTFY_FAILURE_PRIORITY")
+		if failurePriority == "" {
+			failurePriority = "high"
+		}
+		notifiers = append(notifiers, newNtfyNotifier(ntfyURL, os.Getenv("NTFY_TOKEN"),
+			os.Getenv("NTFY_PRIORITY"), failurePriority, os.Getenv("NTFY_TAGS")))
+	}
+
+	if notifyURLs := os.Getenv("NOTIFY_URLS"); notifyURLs != "" {
+		sender, err := newShoutrrrNotifier(notifyURLs)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("invalid NOTIFY_URLS environment variable")
+		}
+		notifiers = append(notifiers, sender)
+	}
+
+	preUpdateHook = os.Getenv("PRE_UPDATE_HOOK")
+	postUpdateHook = os.Getenv("POST_UPDATE_HOOK")
+
+	if wireGuardPeersStr := os.Getenv("WIREGUARD_PEERS"); wireGuardPeersStr != "" {
+		wireGuardPeers, err = parseWireGuardPeers(wireGuardPeersStr)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("invalid WIREGUARD_PEERS environment variable")
+		}
+	}
+
+	hookTimeoutStr := os.Getenv("HOOK_TIMEOUT")
+	if hookTimeoutStr != "" {
+		hookTimeout, err = time.ParseDuration(hookTimeoutStr)
+		if err != nil {
+			logger.Fatal().Msg("invalid HOOK_TIMEOUT environment variable")
+		}
+	}
+
+	if checkIPTimeoutStr := os.Getenv("CHECK_IP_TIMEOUT"); checkIPTimeoutStr != "" {
+		ipsource.Timeout, err = time.ParseDuration(checkIPTimeoutStr)
+		if err != nil || ipsource.Timeout <= 0 {
+			logger.Fatal().Msg("invalid CHECK_IP_TIMEOUT environment variable")
+		}
+	}
+
+	execTimeoutStr := os.Getenv("EXEC_TIMEOUT")
+	if execTimeoutStr != "" {
+		ipsource.ExecTimeout, err = time.ParseDuration(execTimeoutStr)
+		if err != nil || ipsource.ExecTimeout <= 0 {
+			logger.Fatal().Msg("invalid EXEC_TIMEOUT environment variable")
+		}
+	}
+
+	if breakerThresholdStr := os.Getenv("CIRCUIT_BREAKER_THRESHOLD"); breakerThresholdStr != "" {
+		ipsource.BreakerThreshold, err = strconv.Atoi(breakerThresholdStr)
+		if err != nil || ipsource.BreakerThreshold < 0 {
+			logger.Fatal().Msg("invalid CIRCUIT_BREAKER_THRESHOLD environment variable")
+		}
+	}
+	if breakerCooldownStr := os.Getenv("CIRCUIT_BREAKER_COOLDOWN"); breakerCooldownStr != "" {
+		ipsource.BreakerCooldown, err = time.ParseDuration(breakerCooldownStr)
+		if err != nil || ipsource.BreakerCooldown <= 0 {
+			logger.Fatal().Msg("invalid CIRCUIT_BREAKER_COOLDOWN environment variable")
+		}
+	}
+	if noKeepAliveStr := os.Getenv("CHECK_IP_NO_KEEPALIVE"); noKeepAliveStr != "" {
+		ipsource.DisableKeepAlives, err = strconv.ParseBool(noKeepAliveStr)
+		if err != nil {
+			logger.Fatal().Msg("invalid CHECK_IP_NO_KEEPALIVE environment variable")
+		}
+	}
+	if bindAddressStr := os.Getenv("CHECK_IP_BIND_ADDRESS"); bindAddressStr != "" {
+		if net.ParseIP(bindAddressStr) == nil {
+			logger.Fatal().Msg("invalid CHECK_IP_BIND_ADDRESS environment variable")
+		}
+		ipsource.LocalAddress = bindAddressStr
+	}
+	if bindInterfaceStr := os.Getenv("CHECK_IP_BIND_INTERFACE"); bindInterfaceStr != "" {
+		if _, err := net.InterfaceByName(bindInterfaceStr); err != nil {
+			logger.Fatal().Err(err).Msg("invalid CHECK_IP_BIND_INTERFACE environment variable")
+		}
+		ipsource.LocalInterface = bindInterfaceStr
+	}
+	if checkIPOrderStr := os.Getenv("CHECK_IP_ORDER"); checkIPOrderStr != "" {
+		if checkIPOrderStr != "fixed" && checkIPOrderStr != "adaptive" {
+			logger.Fatal().Msg("invalid CHECK_IP_ORDER environment variable")
+		}
+		ipsource.AdaptiveOrder = checkIPOrderStr == "adaptive"
+	}
+
+	verifyIntervalStr := os.Getenv("VERIFY_INTERVAL")
+	if verifyIntervalStr != "" {
+		verifyInterval, err = time.ParseDuration(verifyIntervalStr)
+		if err != nil {
+			logger.Fatal().Msg("invalid VERIFY_INTERVAL environment variable")
+		}
+	}
+
+	if route53DailyBudgetStr := os.Getenv("ROUTE53_DAILY_BUDGET"); route53DailyBudgetStr != "" {
+		route53DailyBudget, err = strconv.Atoi(route53DailyBudgetStr)
+		if err != nil || route53DailyBudget < 0 {
+			logger.Fatal().Msg("invalid ROUTE53_DAILY_BUDGET environment variable")
+		}
+	}
+
+	if recordSourceStr := os.Getenv("RECORD_SOURCE"); recordSourceStr != "" {
+		recordSource = recordSourceStr
+		if recordSource != recordSourceAPI && recordSource != recordSourceDNS {
+			logger.Fatal().Msg("invalid RECORD_SOURCE environment variable")
+		}
+		if recordSource == recordSourceDNS && routingPolicy != updater.RoutingSimple {
+			logger.Fatal().Msg("RECORD_SOURCE=dns cannot be used with a ROUTING_POLICY")
+		}
+	}
+
+	if multiValueModeStr := os.Getenv("MULTI_VALUE_MODE"); multiValueModeStr != "" {
+		multiValueMode = multiValueModeStr
+		if multiValueMode != multiValueReplace && multiValueMode != multiValueMerge {
+			logger.Fatal().Msg("invalid MULTI_VALUE_MODE environment variable")
+		}
+	}
+
+	if driftActionStr := os.Getenv("DRIFT_ACTION"); driftActionStr != "" {
+		driftAction = driftActionStr
+		if driftAction != updater.DriftReassert && driftAction != updater.DriftAlert {
+			logger.Fatal().Msg("invalid DRIFT_ACTION environment variable")
+		}
+	}
+
+	replaceAliasStr := os.Getenv("REPLACE_ALIAS")
+	if replaceAliasStr != "" {
+		replaceAlias, err = strconv.ParseBool(replaceAliasStr)
+		if err != nil {
+			logger.Fatal().Msg("invalid REPLACE_ALIAS environment variable")
+		}
+	}
+
+	if metadataRecordStr := os.Getenv("METADATA_RECORD"); metadataRecordStr != "" {
+		metadataRecord, err = provider.NormalizeName(metadataRecordStr)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("invalid METADATA_RECORD environment variable")
+		}
+	}
+	if cnameTargetStr := os.Getenv("CNAME_TARGET"); cnameTargetStr != "" {
+		cnameTarget, err = provider.NormalizeName(cnameTargetStr)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("invalid CNAME_TARGET environment variable")
+		}
+	}
+	reverseHostedZoneId = os.Getenv("REVERSE_HOSTED_ZONE_ID")
+	if cnameTarget != "" && (staticIP != "" || ifaceName != "" || healthCheckType != "") {
+		logger.Fatal().Msg("CNAME_TARGET cannot be used with STATIC_IP, INTERFACE or HEALTH_CHECK_TYPE")
+	}
+
+	if srvRecordStr := os.Getenv("SRV_RECORD"); srvRecordStr != "" {
+		srvRecord, err = provider.NormalizeName(srvRecordStr)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("invalid SRV_RECORD environment variable")
+		}
+	}
+	if srvPriorityStr := os.Getenv("SRV_PRIORITY"); srvPriorityStr != "" {
+		srvPriority, err = strconv.ParseUint(srvPriorityStr, 10, 16)
+		if err != nil {
+			logger.Fatal().Msg("invalid SRV_PRIORITY environment variable")
+		}
+	}
+	if srvWeightStr := os.Getenv("SRV_WEIGHT"); srvWeightStr != "" {
+		srvWeight, err = strconv.ParseUint(srvWeightStr, 10, 16)
+		if err != nil {
+			logger.Fatal().Msg("invalid SRV_WEIGHT environment variable")
+		}
+	}
+	if srvPortStr := os.Getenv("SRV_PORT"); srvPortStr != "" {
+		srvPort, err = strconv.ParseUint(srvPortStr, 10, 16)
+		if err != nil || srvPort == 0 {
+			logger.Fatal().Msg("invalid SRV_PORT environment variable")
+		}
+	}
+	srvPortFile = os.Getenv("SRV_PORT_FILE")
+	if srvRecord != "" && srvPort == 0 && srvPortFile == "" {
+		logger.Fatal().Msg("missing SRV_PORT environment variable")
+	}
+	if srvTargetStr := os.Getenv("SRV_TARGET"); srvTargetStr != "" {
+		srvTarget, err = provider.NormalizeName(srvTargetStr)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("invalid SRV_TARGET environment variable")
+		}
+	}
+	if srvTarget == "" {
+		srvTarget = dnsName
+	}
+
+	adminSocket = os.Getenv("ADMIN_SOCKET")
+
+	cloudWatchLogGroup = os.Getenv("CLOUDWATCH_LOG_GROUP")
+	cloudWatchLogStream = os.Getenv("CLOUDWATCH_LOG_STREAM")
+	if cloudWatchLogStream == "" {
+		cloudWatchLogStream, _ = os.Hostname()
+	}
+	if flushIntervalStr := os.Getenv("CLOUDWATCH_FLUSH_INTERVAL"); flushIntervalStr != "" {
+		cloudWatchFlushInterval, err = time.ParseDuration(flushIntervalStr)
+		if err != nil || cloudWatchFlushInterval <= 0 {
+			logger.Fatal().Msg("invalid CLOUDWATCH_FLUSH_INTERVAL environment variable")
+		}
+	}
+
+	lokiURL = os.Getenv("LOKI_URL")
+	hostname, _ := os.Hostname()
+	lokiLabels = map[string]string{"job": "update-route53", "host": hostname}
+	if lokiLabelsStr := os.Getenv("LOKI_LABELS"); lokiLabelsStr != "" {
+		if err := parseLokiLabels(lokiLabelsStr, lokiLabels); err != nil {
+			logger.Fatal().Err(err).Msg("invalid LOKI_LABELS environment variable")
+		}
+	}
+	if flushIntervalStr := os.Getenv("LOKI_FLUSH_INTERVAL"); flushIntervalStr != "" {
+		lokiFlushInterval, err = time.ParseDuration(flushIntervalStr)
+		if err != nil || lokiFlushInterval <= 0 {
+			logger.Fatal().Msg("invalid LOKI_FLUSH_INTERVAL environment variable")
+		}
+	}
+
+	stateFile = os.Getenv("STATE_FILE")
+	if stateFile != "" {
+		if err := loadState(stateFile); err != nil {
+			logger.Fatal().Err(err).Msg("unable to load state file")
+		}
+	}
+
+	auditLogPath = os.Getenv("AUDIT_LOG")
+
+	if auditMaxEntriesStr := os.Getenv("AUDIT_LOG_MAX_ENTRIES"); auditMaxEntriesStr != "" {
+		auditMaxEntries, err = strconv.Atoi(auditMaxEntriesStr)
+		if err != nil || auditMaxEntries < 0 {
+			logger.Fatal().Msg("invalid AUDIT_LOG_MAX_ENTRIES environment variable")
+		}
+	}
+
+	if auditMaxAgeStr := os.Getenv("AUDIT_LOG_MAX_AGE"); auditMaxAgeStr != "" {
+		auditMaxAge, err = time.ParseDuration(auditMaxAgeStr)
+		if err != nil || auditMaxAge < 0 {
+			logger.Fatal().Msg("invalid AUDIT_LOG_MAX_AGE environment variable")
+		}
+	}
 
 	// Log startup message
 	logger.Info().
+		Str("version", buildVersion()).
+		Str("dnsName", provider.DisplayName(dnsName)).
+		Str("hostedZoneId", hostedZoneId).
+		Bool("operator", *operator).
 		Str("checkIPURL", checkIPURL).
+		Str("staticIP", staticIP).
+		Str("interface", ifaceName).
+		Bool("privateZone", privateZone).
+		Str("routingPolicy", routingPolicy).
 		Str("sleepPeriod", sleepPeriod.String()).
+		Str("schedule", scheduleStr).
+		Float64("sleepJitter", sleepJitter).
+		Uint64("confirmations", confirmations).
+		Str("minChangeInterval", minChangeInterval.String()).
 		Uint64("dnsTTL", dnsTTL).
 		Msg("starting route53-updater...")
 
+	// The history commands do not need AWS
+	if command == "history prune" {
+		os.Exit(runHistoryPrune())
+	}
+
 	// Load AWS configuration
-	cfg, err := config.LoadDefaultConfig(context.TODO())
+	cfg, err := config.LoadDefaultConfig(context.TODO(), awsConfigOptions()...)
 	if err != nil {
 		logger.Err(err).Msg("unable to load aws configuration")
 	}
@@ -239,6 +1119,157 @@ func main() {
 	// Create Route53 client
 	svc := route53.NewFromConfig(cfg)
 
+	// Create EC2 client, to look up the public address of ECS tasks
+	ipsource.EC2 = ec2.NewFromConfig(cfg)
+
+	// Record the submitted changes in the audit log, if configured, pruning
+	// the old entries
+	if auditLogPath != "" {
+		if err := openAuditLog(sts.NewFromConfig(cfg)); err != nil {
+			logger.Fatal().Err(err).Msg("unable to open audit log")
+		}
+		if auditRetention() {
+			if _, pruned, err := pruneAuditLog(); err != nil {
+				logger.Err(err).Msg("unable to prune audit log")
+			} else if pruned > 0 {
+				logger.Info().Int("pruned", pruned).Msg("pruned audit log")
+			}
+		}
+	}
+
+	// Use a distributed lock around changes, if configured
+	if lockTable := os.Getenv("LOCK_TABLE"); lockTable != "" {
+		owner, _ := os.Hostname()
+		locker = &dynamoLock{
+			svc:   dynamodb.NewFromConfig(cfg),
+			table: lockTable,
+			owner: fmt.Sprintf("%s/%d", owner, os.Getpid()),
+		}
+	}
+
+	// Also ship logs to CloudWatch Logs and Loki, if configured
+	logOutputs := []io.Writer{logOut}
+	if cloudWatchLogGroup != "" && command == "" {
+		cloudWatchLogs = newCloudWatchWriter(cloudwatchlogs.NewFromConfig(cfg),
+			cloudWatchLogGroup, cloudWatchLogStream, cloudWatchFlushInterval)
+		logOutputs = append(logOutputs, cloudWatchLogs)
+	}
+	if lokiURL != "" && command == "" {
+		lokiLogs = newLokiWriter(lokiURL, lokiLabels, lokiFlushInterval)
+		logOutputs = append(logOutputs, lokiLogs)
+	}
+	if len(logOutputs) > 1 {
+		logger = logger.Output(zerolog.MultiLevelWriter(logOutputs...))
+	}
+
+	// Publish events to SNS, if configured
+	if topicArn := os.Getenv("SNS_TOPIC_ARN"); topicArn != "" {
+		notifiers = append(notifiers, &snsNotifier{svc: sns.NewFromConfig(cfg), topicArn: topicArn})
+	}
+
+	// Put change events on an EventBridge bus, if configured
+	if eventBus := os.Getenv("EVENT_BUS"); eventBus != "" {
+		notifiers = append(notifiers, &eventBridgeNotifier{svc: eventbridge.NewFromConfig(cfg), eventBus: eventBus})
+	}
+
+	// Records managed by this instance
+	records := []record{{
+		Name:         dnsName,
+		HostedZoneId: hostedZoneId,
+		TTL:          dnsTTL,
+		CheckIPURL:   checkIPURL,
+		StaticIP:     staticIP,
+		Interface:    ifaceName,
+		PrivateZone:  privateZone,
+
+		RoutingPolicy: routingPolicy,
+		SetIdentifier: setIdentifier,
+		HealthCheckId: healthCheckId,
+		Weight:        weight,
+
+		GeoContinent:   geoContinent,
+		GeoCountry:     geoCountry,
+		GeoSubdivision: geoSubdivision,
+
+		Failover: failover,
+
+		ManageHealthCheck: healthCheckType != "",
+
+		CNAMETarget: cnameTarget,
+
+		IPv6:         ipv6Record,
+		PrefixLength: ipv6PrefixLength,
+		Suffix:       ipv6Suffix,
+		IID:          ipv6IID,
+	}}
+
+	// Split-horizon: the same name also gets the LAN address in a private zone
+	if privateHostedZoneId != "" {
+		records = append(records, record{
+			Name:         dnsName,
+			HostedZoneId: privateHostedZoneId,
+			TTL:          privateDNSTTL,
+			Interface:    privateIfaceName,
+			PrivateZone:  true,
+		})
+	}
+
+	records = append(records, extraRecords...)
+
+	// Very low TTLs increase the query load and are often clamped by resolvers
+	for _, rec := range records {
+		if rec.TTL < 30 {
+			logger.Warn().
+				Str("dnsName", provider.DisplayName(rec.Name)).
+				Str("hostedZoneId", rec.HostedZoneId).
+				Uint64("ttl", rec.TTL).
+				Msg("TTL is below 30 seconds")
+		}
+	}
+
+	// Refuse to take over records that belong to something else
+	if protectExisting && !*force && command != "config validate" && command != "get" {
+		if err := protectRecords(svc, records); err != nil {
+			logger.Fatal().Err(err).Msg("unable to check existing records")
+		}
+	}
+
+	// Run the command instead of the main loop. Only the DNS_NAME record is
+	// changed by set, delete and hook.
+	switch command {
+	case "config validate":
+		os.Exit(runConfigValidate(svc, records, *checkAWS))
+	case "get":
+		os.Exit(runGet(svc, records))
+	case "set":
+		os.Exit(runSet(svc, records[0], setAddress))
+	case "delete":
+		os.Exit(runDelete(svc, records[0]))
+	case "hook":
+		os.Exit(runNetworkHook(svc, records[0]))
+	}
+
+	// Run the update cycles with the options of the environment
+	recordUpdater = newUpdater(svc, updater.WithMetrics(prometheus.DefaultRegisterer))
+
+	// Warn if the hosted zone does not match PRIVATE_ZONE
+	if privateZone && hostedZoneId != "" {
+		zone, err := svc.GetHostedZone(context.TODO(), &route53.GetHostedZoneInput{
+			Id: aws.String(hostedZoneId),
+		})
+		if err != nil {
+			logger.Err(err).Msg("unable to get hosted zone")
+		} else if zone.HostedZone.Config == nil || !zone.HostedZone.Config.PrivateZone {
+			logger.Warn().Msg("PRIVATE_ZONE is set but the hosted zone is not private")
+		}
+	}
+
+	// When running inside AWS Lambda, handle one cycle per invocation and
+	// skip the health check server
+	if runtimeAPI := os.Getenv("AWS_LAMBDA_RUNTIME_API"); runtimeAPI != "" {
+		runLambda(svc, records, runtimeAPI)
+	}
+
 	// Start health check server
 	go func() {
 		http.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
@@ -250,21 +1281,138 @@ func main() {
 		// Add Prometheus metrics endpoint
 		http.Handle("/metrics", promhttp.Handler())
 
-		http.ListenAndServe(fmt.Sprintf(":%d", *port), nil)
+		// Add status endpoint, used by the status command
+		http.HandleFunc("/status", handleStatus)
+
+		// Also serve the endpoints on a unix socket, if configured
+		if adminSocket != "" {
+			go func() {
+				err := serveAdminSocket(adminSocket)
+				logger.Err(err).Str("adminSocket", adminSocket).Msg("stopped serving admin socket")
+			}()
+		}
+
+		http.ListenAndServe(fmt.Sprintf(":%d", serverPort), nil)
 	}()
 
+	// Elect a leader among replicas, if enabled
+	var elector *leaderElector
+	if *leaderElect {
+		kube, err := newInClusterKubeClient()
+		if err != nil {
+			logger.Fatal().Err(err).Msg("unable to create kubernetes client")
+		}
+		leaseName := os.Getenv("LEADER_ELECTION_LEASE")
+		if leaseName == "" {
+			leaseName = "update-route53"
+		}
+		identity := os.Getenv("POD_NAME")
+		if identity == "" {
+			identity, _ = os.Hostname()
+		}
+		elector = newLeaderElector(kube, leaseName, identity)
+		go elector.run()
+	}
+
+	// In operator mode, records come from DNSRecord custom resources
+	if *operator {
+		runOperator(svc, elector)
+	}
+
+	// Delete or revert the records on graceful shutdown, if enabled
+	if onShutdown != shutdownActionNone {
+		originals := make([]*types.ResourceRecordSet, len(records))
+		if onShutdown == shutdownActionRevert {
+			for i, rec := range records {
+				originals[i], err = getRecordSet(svc, rec)
+				if err != nil {
+					logger.Fatal().Err(err).Msg("unable to get original record value")
+				}
+			}
+		}
+		go handleShutdown(svc, records, onShutdown, originals)
+	}
+
+	// Exit after the maximum runtime, if set
+	if runFor > 0 {
+		go exitAfter(runFor)
+	}
+
+	// Trigger updates when the address of the WAN interface changes
+	if watchIfaceName != "" {
+		go func() {
+			err := watchInterfaceAddresses(watchIfaceName)
+			logger.Err(err).Msg("stopped watching interface addresses")
+		}()
+	}
+
+	// Trigger updates when the trigger file is touched
+	if triggerFile != "" {
+		go func() {
+			err := watchTriggerFile(triggerFile)
+			logger.Err(err).Msg("stopped watching trigger file")
+		}()
+	}
+
+	// Connect to the MQTT broker, if configured. Messages received on the
+	// trigger topic trigger an update.
+	if mqttBroker != "" {
+		mqttClient, err = newMQTTClient(mqttBroker,
+			os.Getenv("MQTT_USERNAME"), os.Getenv("MQTT_PASSWORD"), os.Getenv("MQTT_CLIENT_ID"),
+			mqttTriggerTopic)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("unable to connect to mqtt broker")
+		}
+	}
+
+	// Publish change events to MQTT, if configured
+	if mqttPublishTopic != "" {
+		notifiers = append(notifiers, &mqttNotifier{client: mqttClient, topic: mqttPublishTopic})
+	}
+
+	// Ping the systemd watchdog from the main loop, if enabled
+	watchdogInterval := sdWatchdogInterval()
+
 	// Start the main loop
+	ready := false
+	triggered := false
 	for {
 		// Start the duration timer
 		start := time.Now()
 
-		// Update Route53
-		updateRoute53(svc)
+		// Check all records when triggered, otherwise only those that are due
+		due := records
+		if !triggered {
+			due = dueRecords(records, start)
+		}
+
+		// Update Route53, unless another replica is the leader
+		var err error
+		cycleMu.Lock()
+		if elector == nil || elector.isLeader() {
+			err = updateRecordsRecovered(svc, due)
+		} else {
+			logger.Debug().Msg("not the leader, skipping update")
+		}
+		publishStatus(records)
+		cycleMu.Unlock()
 
 		// Record the duration
 		updateDuration.Add(float64(time.Since(start).Seconds()))
 
-		// Wait before checking again
-		time.Sleep(sleepPeriod)
+		// Notify systemd after the first successful cycle
+		if err == nil && !ready {
+			ready = true
+			if err := sdNotify("READY=1"); err != nil {
+				logger.Err(err).Msg("unable to notify systemd")
+			}
+		}
+		if watchdogInterval > 0 {
+			sdNotify("WATCHDOG=1")
+		}
+
+		// Wait until the next record is due
+		scheduleRecords(due, start, nextSleepPeriod())
+		triggered = sleepWithWatchdog(untilNextCheck(records), watchdogInterval)
 	}
 }
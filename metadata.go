@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+// metadataChange returns the change that updates the metadata TXT record of
+// the given record after it was set to address.
+func metadataChange(rec record, address string) types.Change {
+	hostname, _ := os.Hostname()
+	values := []string{
+		fmt.Sprintf(`"updated=%s"`, time.Now().UTC().Format(time.RFC3339)),
+		fmt.Sprintf(`"address=%s"`, address),
+		fmt.Sprintf(`"host=%s"`, hostname),
+		fmt.Sprintf(`"version=%s"`, buildVersion()),
+	}
+	recordSet := &types.ResourceRecordSet{
+		Name:            aws.String(metadataRecord),
+		Type:            types.RRTypeTxt,
+		TTL:             aws.Int64(int64(rec.TTL)),
+		ResourceRecords: []types.ResourceRecord{{Value: aws.String(strings.Join(values, " "))}},
+	}
+	rec.ApplyRouting(recordSet, false)
+	return types.Change{
+		Action:            types.ChangeActionUpsert,
+		ResourceRecordSet: recordSet,
+	}
+}
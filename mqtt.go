@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// newMQTTClient connects to the MQTT broker. If triggerTopic is not empty, an
+// update cycle is triggered whenever a message is received on that topic.
+// The client reconnects automatically and subscribes again on every
+// connection.
+func newMQTTClient(broker, username, password, clientID, triggerTopic string) (mqtt.Client, error) {
+	if clientID == "" {
+		hostname, _ := os.Hostname()
+		clientID = fmt.Sprintf("update-route53-%s-%d", hostname, os.Getpid())
+	}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(broker).
+		SetClientID(clientID).
+		SetUsername(username).
+		SetPassword(password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectTimeout(10 * time.Second).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			logger.Err(err).Msg("mqtt connection lost")
+		}).
+		SetOnConnectHandler(func(client mqtt.Client) {
+			logger.Info().Str("broker", broker).Msg("connected to mqtt broker")
+			if triggerTopic == "" {
+				return
+			}
+			token := client.Subscribe(triggerTopic, 1, func(_ mqtt.Client, msg mqtt.Message) {
+				logger.Info().Str("topic", msg.Topic()).Msg("mqtt trigger received")
+				triggerUpdate()
+			})
+			if token.Wait() && token.Error() != nil {
+				logger.Err(token.Error()).Str("topic", triggerTopic).Msg("unable to subscribe to mqtt trigger topic")
+			}
+		})
+
+	client := mqtt.NewClient(opts)
+	token := client.Connect()
+	if !token.WaitTimeout(10 * time.Second) {
+		logger.Warn().Str("broker", broker).Msg("mqtt broker not reachable yet, retrying in the background")
+		return client, nil
+	}
+	if err := token.Error(); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// mqttNotifier publishes change events as JSON to an MQTT topic.
+type mqttNotifier struct {
+	client mqtt.Client
+	topic  string
+}
+
+func (n *mqttNotifier) name() string {
+	return "mqtt"
+}
+
+func (n *mqttNotifier) notify(ev event) error {
+	if ev.Type != eventChange {
+		return nil
+	}
+
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	token := n.client.Publish(n.topic, 1, false, payload)
+	if !token.WaitTimeout(10 * time.Second) {
+		return errors.New("timeout publishing to mqtt broker")
+	}
+	return token.Error()
+}
@@ -0,0 +1,7 @@
+package main
+
+// Handling of record sets with multiple values (MULTI_VALUE_MODE)
+const (
+	multiValueReplace = "replace" // Replace all values with the current address
+	multiValueMerge   = "merge"   // Only replace the value owned by this instance
+)
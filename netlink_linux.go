@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// watchInterfaceAddresses subscribes to rtnetlink address notifications and
+// triggers an update cycle whenever an address is added to or removed from
+// the named interface. It only returns on error.
+func watchInterfaceAddresses(name string) error {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return fmt.Errorf("unable to find interface: %w", err)
+	}
+
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return fmt.Errorf("unable to open netlink socket: %w", err)
+	}
+	defer syscall.Close(fd)
+
+	addr := &syscall.SockaddrNetlink{
+		Family: syscall.AF_NETLINK,
+		Groups: unix.RTMGRP_IPV4_IFADDR | unix.RTMGRP_IPV6_IFADDR,
+	}
+	if err := syscall.Bind(fd, addr); err != nil {
+		return fmt.Errorf("unable to bind netlink socket: %w", err)
+	}
+
+	buf := make([]byte, 65536)
+	for {
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if err != nil {
+			if err == syscall.EINTR {
+				continue
+			}
+			return fmt.Errorf("unable to read netlink socket: %w", err)
+		}
+
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			return fmt.Errorf("unable to parse netlink message: %w", err)
+		}
+		for _, msg := range msgs {
+			if msg.Header.Type != syscall.RTM_NEWADDR && msg.Header.Type != syscall.RTM_DELADDR {
+				continue
+			}
+			if len(msg.Data) < syscall.SizeofIfAddrmsg {
+				continue
+			}
+			ifaddr := (*syscall.IfAddrmsg)(unsafe.Pointer(&msg.Data[0]))
+			if int(ifaddr.Index) != iface.Index {
+				continue
+			}
+
+			logger.Info().
+				Str("interface", name).
+				Bool("added", msg.Header.Type == syscall.RTM_NEWADDR).
+				Msg("interface address changed")
+			triggerUpdate()
+		}
+	}
+}
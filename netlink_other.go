@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+)
+
+// watchInterfaceAddresses is only supported on Linux.
+func watchInterfaceAddresses(name string) error {
+	return errors.New("watching interface addresses is only supported on linux")
+}
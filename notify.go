@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+// Types of events sent to notifiers
+const (
+	eventChange   = "change"
+	eventFailure  = "failure"
+	eventRecovery = "recovery"
+	eventDNSSEC   = "dnssec"
+	eventDrift    = "drift"
+	eventBudget   = "budget"
+)
+
+// event describes a record change, an update failure, the recovery of a
+// record after failures, a change that failed DNSSEC validation, a change of
+// the record by someone else, or the exhaustion of the daily API budget.
+type event struct {
+	Type          string    `json:"type"`
+	Record        string    `json:"record"`
+	HostedZoneId  string    `json:"hostedZoneId"`
+	RecordType    string    `json:"recordType,omitempty"`
+	SetIdentifier string    `json:"setIdentifier,omitempty"`
+	OldAddress    string    `json:"oldAddress,omitempty"`
+	NewAddress    string    `json:"newAddress,omitempty"`
+	TTL           uint64    `json:"ttl,omitempty"`
+	ChangeId      string    `json:"changeId,omitempty"`
+	Error         string    `json:"error,omitempty"`
+	Timestamp     time.Time `json:"timestamp"`
+
+	// Time from change submission until it was INSYNC
+	PropagationSeconds float64 `json:"propagationSeconds,omitempty"`
+}
+
+// key returns the key of the record of the event, as returned by record.Key.
+func (ev event) key() string {
+	return record{
+		Name:          ev.Record,
+		HostedZoneId:  ev.HostedZoneId,
+		SetIdentifier: ev.SetIdentifier,
+		IPv6:          ev.RecordType == string(types.RRTypeAaaa),
+	}.Key()
+}
+
+// notifier delivers events to an external system.
+type notifier interface {
+	// name identifies the notifier in logs
+	name() string
+	notify(ev event) error
+}
+
+// notifiers configured for this instance
+var notifiers []notifier
+
+// Consecutive failed cycles of each record
+var consecutiveFailures = map[string]uint64{}
+
+// recordCycleResult tracks consecutive failures of the given record. Once
+// failureThreshold cycles in a row have failed, every failed cycle sends a
+// failure event (throttled per notifier), and the next successful cycle
+// sends a recovery event.
+func recordCycleResult(rec record, err error) {
+	ev := event{
+		Record:        rec.Name,
+		HostedZoneId:  rec.HostedZoneId,
+		RecordType:    string(rec.RecordType()),
+		SetIdentifier: rec.SetIdentifier,
+		Timestamp:     time.Now().UTC(),
+	}
+
+	if err == nil {
+		if consecutiveFailures[rec.Key()] >= failureThreshold {
+			ev.Type = eventRecovery
+			notify(ev)
+		}
+		consecutiveFailures[rec.Key()] = 0
+		return
+	}
+
+	consecutiveFailures[rec.Key()]++
+	if consecutiveFailures[rec.Key()] >= failureThreshold {
+		ev.Type = eventFailure
+		ev.Error = err.Error()
+		notify(ev)
+	}
+}
+
+// notifyThrottle deduplicates failure events sent to a notifier: the first
+// failure of a record is sent immediately, then at most one reminder every
+// notifyReminderInterval, and a recovery event once the record recovers.
+type notifyThrottle struct {
+	lastFailure map[string]time.Time // Last failure sent for each record
+}
+
+// throttles of each notifier
+var throttles = map[notifier]*notifyThrottle{}
+
+// notifyMu serializes notifications, which are also sent by the background
+// DNSSEC validations.
+var notifyMu sync.Mutex
+
+// allow reports whether the event should be sent, updating the throttle
+// state accordingly.
+func (t *notifyThrottle) allow(ev event) bool {
+	key := ev.key()
+	last, failing := t.lastFailure[key]
+
+	switch ev.Type {
+	case eventFailure:
+		if failing && ev.Timestamp.Sub(last) < notifyReminderInterval {
+			return false
+		}
+		t.lastFailure[key] = ev.Timestamp
+	case eventRecovery:
+		if !failing {
+			return false
+		}
+		delete(t.lastFailure, key)
+	}
+	return true
+}
+
+// notify sends the event to all configured notifiers. Failures are logged
+// but do not affect the update cycle.
+func notify(ev event) {
+	notifyMu.Lock()
+	defer notifyMu.Unlock()
+	for _, n := range notifiers {
+		throttle := throttles[n]
+		if throttle == nil {
+			throttle = &notifyThrottle{lastFailure: map[string]time.Time{}}
+			throttles[n] = throttle
+		}
+		if !throttle.allow(ev) {
+			continue
+		}
+
+		if err := n.notify(ev); err != nil {
+			logger.Err(err).
+				Str("notifier", n.name()).
+				Str("event", ev.Type).
+				Msg("unable to send notification")
+		}
+	}
+}
+
+// eventTitle returns a short title for the event, or an empty string for
+// unknown event types.
+func eventTitle(ev event) string {
+	switch ev.Type {
+	case eventChange:
+		return fmt.Sprintf("%s changed", ev.Record)
+	case eventFailure:
+		return fmt.Sprintf("%s update failing", ev.Record)
+	case eventRecovery:
+		return fmt.Sprintf("%s recovered", ev.Record)
+	case eventDNSSEC:
+		return fmt.Sprintf("%s DNSSEC validation failed", ev.Record)
+	case eventDrift:
+		return fmt.Sprintf("%s changed externally", ev.Record)
+	case eventBudget:
+		return "Route53 API budget exceeded"
+	}
+	return ""
+}
+
+// templateFuncs are the functions available in notification templates.
+var templateFuncs = template.FuncMap{
+	// json encodes a value as JSON, e.g. to quote a string
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	// duration formats a number of seconds as a duration, e.g. 1m5s
+	"duration": func(seconds float64) string {
+		return time.Duration(seconds * float64(time.Second)).Round(time.Second).String()
+	},
+}
+
+// Templates replacing the built-in notification messages (NOTIFY_CHANGE_TEMPLATE,
+// NOTIFY_FAILURE_TEMPLATE, and NOTIFY_RECOVERY_TEMPLATE environment variables)
+var messageTemplates = map[string]*template.Template{}
+
+// parseMessageTemplate parses a notification message template for the given
+// event type.
+func parseMessageTemplate(eventType, text string) error {
+	tmpl, err := template.New(eventType).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return err
+	}
+	messageTemplates[eventType] = tmpl
+	return nil
+}
+
+// hasMessageTemplate reports whether a custom message template is configured
+// for the event type.
+func hasMessageTemplate(ev event) bool {
+	return messageTemplates[ev.Type] != nil
+}
+
+// eventMessage returns a one line description of the event, rendered from the
+// custom message template if one is configured.
+func eventMessage(ev event) string {
+	if tmpl := messageTemplates[ev.Type]; tmpl != nil {
+		var buf bytes.Buffer
+		err := tmpl.Execute(&buf, ev)
+		if err == nil {
+			return buf.String()
+		}
+		logger.Err(err).Str("event", ev.Type).Msg("unable to render message template")
+	}
+
+	switch ev.Type {
+	case eventChange:
+		return fmt.Sprintf("%s → %s (propagated in %.0fs)",
+			valueOrNone(ev.OldAddress), ev.NewAddress, ev.PropagationSeconds)
+	case eventFailure, eventDNSSEC, eventBudget:
+		return ev.Error
+	case eventRecovery:
+		return "updates are succeeding again"
+	case eventDrift:
+		return fmt.Sprintf("%s → %s (changed by someone else)", ev.OldAddress, valueOrNone(ev.NewAddress))
+	}
+	return ""
+}
+
+// valueOrNone returns value, or "none" if it is empty.
+func valueOrNone(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return value
+}
+
+// postJSON posts the JSON encoding of payload to url and checks the response
+// status.
+func postJSON(client *http.Client, url string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s returned %s", resp.Request.URL.Host, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ntfyNotifier publishes events to an ntfy topic (ntfy.sh or self-hosted).
+type ntfyNotifier struct {
+	url             string
+	token           string
+	priority        string
+	failurePriority string
+	tags            string
+	client          *http.Client
+}
+
+func newNtfyNotifier(url, token, priority, failurePriority, tags string) *ntfyNotifier {
+	return &ntfyNotifier{
+		url:             url,
+		token:           token,
+		priority:        priority,
+		failurePriority: failurePriority,
+		tags:            tags,
+		client:          &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (n *ntfyNotifier) name() string {
+	return "ntfy"
+}
+
+func (n *ntfyNotifier) notify(ev event) error {
+	var priority string
+	tags := []string{}
+	switch ev.Type {
+	case eventChange:
+		priority = n.priority
+		tags = append(tags, "globe_with_meridians")
+	case eventFailure, eventDNSSEC, eventDrift, eventBudget:
+		priority = n.failurePriority
+		tags = append(tags, "warning")
+	case eventRecovery:
+		priority = n.priority
+		tags = append(tags, "white_check_mark")
+	default:
+		return nil
+	}
+	if n.tags != "" {
+		tags = append(tags, n.tags)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, n.url, strings.NewReader(eventMessage(ev)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Title", eventTitle(ev))
+	req.Header.Set("Tags", strings.Join(tags, ","))
+	if priority != "" {
+		req.Header.Set("Priority", priority)
+	}
+	if n.token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.token)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("ntfy returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"flouret.io/update-route53/pkg/provider"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+)
+
+// API group and version of the DNSRecord custom resource
+const (
+	dnsRecordAPIVersion = "route53.flouret.io/v1alpha1"
+	dnsRecordResource   = "dnsrecords"
+)
+
+// dnsRecord is the DNSRecord custom resource reconciled in operator mode.
+type dnsRecord struct {
+	Metadata struct {
+		Name       string `json:"name"`
+		Namespace  string `json:"namespace"`
+		Generation int64  `json:"generation"`
+	} `json:"metadata"`
+	Spec struct {
+		Name   string `json:"name"`             // DNS name to update
+		Zone   string `json:"zone"`             // Route53 hosted zone id
+		TTL    uint64 `json:"ttl,omitempty"`    // Defaults to DNS_TTL
+		Source string `json:"source,omitempty"` // Defaults to CHECK_IP
+	} `json:"spec"`
+	Status dnsRecordStatus `json:"status"`
+}
+
+type dnsRecordStatus struct {
+	ObservedGeneration int64       `json:"observedGeneration,omitempty"`
+	LastSyncTime       string      `json:"lastSyncTime,omitempty"`
+	Conditions         []condition `json:"conditions,omitempty"`
+}
+
+// condition follows the Kubernetes metav1.Condition conventions.
+type condition struct {
+	Type               string `json:"type"`
+	Status             string `json:"status"`
+	ObservedGeneration int64  `json:"observedGeneration,omitempty"`
+	LastTransitionTime string `json:"lastTransitionTime"`
+	Reason             string `json:"reason"`
+	Message            string `json:"message"`
+}
+
+type dnsRecordList struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Items []dnsRecord `json:"items"`
+}
+
+type dnsRecordEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// runOperator reconciles DNSRecord resources in the watched namespace. All
+// records are reconciled every SLEEP_PERIOD, and changed records as soon as
+// the watch reports them. When elector is not nil, records are only reconciled
+// while this replica is the leader. It never returns.
+func runOperator(svc *route53.Client, elector *leaderElector) {
+	kube, err := newInClusterKubeClient()
+	if err != nil {
+		logger.Fatal().Err(err).Msg("unable to create kubernetes client")
+	}
+
+	namespace := os.Getenv("WATCH_NAMESPACE")
+	if namespace == "" {
+		namespace = kube.namespace
+	}
+	path := fmt.Sprintf("/apis/%s/namespaces/%s/%s", dnsRecordAPIVersion, namespace, dnsRecordResource)
+
+	logger.Info().Str("namespace", namespace).Msg("starting dnsrecord controller")
+
+	for {
+		// Full resync
+		var list dnsRecordList
+		if err := kube.do(context.TODO(), http.MethodGet, path, "", nil, &list); err != nil {
+			logger.Err(err).Msg("unable to list dnsrecords")
+			time.Sleep(10 * time.Second)
+			continue
+		}
+		for i := range list.Items {
+			if elector == nil || elector.isLeader() {
+				reconcileDNSRecord(svc, kube, path, &list.Items[i])
+			}
+		}
+
+		// Watch for changes until the next resync
+		err := watchDNSRecords(svc, kube, elector, path, list.Metadata.ResourceVersion)
+		if err != nil && !isKubeStatus(err, http.StatusGone) {
+			logger.Err(err).Msg("unable to watch dnsrecords")
+			time.Sleep(10 * time.Second)
+		}
+	}
+}
+
+// watchDNSRecords reconciles records as their spec changes. It returns when
+// the watch times out after SLEEP_PERIOD.
+func watchDNSRecords(svc *route53.Client, kube *kubeClient, elector *leaderElector, path, resourceVersion string) error {
+	query := url.Values{
+		"watch":           {"true"},
+		"resourceVersion": {resourceVersion},
+		"timeoutSeconds":  {fmt.Sprint(int(sleepPeriod.Seconds()))},
+	}
+	body, err := kube.stream(context.TODO(), http.MethodGet, path+"?"+query.Encode(), "", nil)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	decoder := json.NewDecoder(body)
+	for {
+		var event dnsRecordEvent
+		if err := decoder.Decode(&event); err != nil {
+			// The server closes the stream when the watch times out
+			return nil
+		}
+
+		switch event.Type {
+		case "ADDED", "MODIFIED":
+			var rec dnsRecord
+			if err := json.Unmarshal(event.Object, &rec); err != nil {
+				return err
+			}
+			// Status updates do not bump the generation
+			if rec.Status.ObservedGeneration != rec.Metadata.Generation &&
+				(elector == nil || elector.isLeader()) {
+				reconcileDNSRecord(svc, kube, path, &rec)
+			}
+		case "DELETED":
+			var rec dnsRecord
+			json.Unmarshal(event.Object, &rec)
+			logger.Info().
+				Str("resource", rec.Metadata.Name).
+				Msg("dnsrecord deleted, route53 record left unchanged")
+		case "ERROR":
+			var status struct {
+				Code    int    `json:"code"`
+				Message string `json:"message"`
+			}
+			json.Unmarshal(event.Object, &status)
+			return &kubeStatusError{StatusCode: status.Code, Message: status.Message}
+		}
+	}
+}
+
+// reconcileDNSRecord updates Route53 for a single resource and writes the
+// result back to the resource status.
+func reconcileDNSRecord(svc *route53.Client, kube *kubeClient, path string, res *dnsRecord) {
+	logger := logger.With().
+		Str("resource", res.Metadata.Name).
+		Str("namespace", res.Metadata.Namespace).
+		Logger()
+
+	rec := record{
+		Name:         res.Spec.Name,
+		HostedZoneId: res.Spec.Zone,
+		TTL:          res.Spec.TTL,
+		CheckIPURL:   checkIPURL,
+	}
+	if rec.TTL == 0 {
+		rec.TTL = dnsTTL
+	}
+	var sourceErr error
+	if res.Spec.Source != "" {
+		sourceErr = rec.SetSource(res.Spec.Source)
+	}
+
+	name, err := provider.NormalizeName(rec.Name)
+	reason := "UpdateFailed"
+	if rec.Name == "" || rec.HostedZoneId == "" {
+		err = fmt.Errorf("spec.name and spec.zone are required")
+		reason = "InvalidSpec"
+	} else if err != nil {
+		err = fmt.Errorf("invalid spec.name: %w", err)
+		reason = "InvalidSpec"
+	} else if rec.TTL > maxTTL {
+		err = fmt.Errorf("spec.ttl is larger than %d", maxTTL)
+		reason = "InvalidSpec"
+	} else if sourceErr != nil {
+		err = fmt.Errorf("invalid spec.source: %w", sourceErr)
+		reason = "InvalidSpec"
+	} else {
+		rec.Name = name
+		start := time.Now()
+		err = updateRoute53(svc, rec)
+		updateDuration.Add(float64(time.Since(start).Seconds()))
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	ready := condition{
+		Type:               "Ready",
+		Status:             "True",
+		ObservedGeneration: res.Metadata.Generation,
+		LastTransitionTime: now,
+		Reason:             "Synced",
+		Message:            "record is up to date",
+	}
+	if err != nil {
+		ready.Status = "False"
+		ready.Reason = reason
+		ready.Message = err.Error()
+	}
+
+	// Keep the transition time if the condition status did not change
+	for _, c := range res.Status.Conditions {
+		if c.Type == ready.Type && c.Status == ready.Status {
+			ready.LastTransitionTime = c.LastTransitionTime
+		}
+	}
+
+	patch := map[string]any{
+		"status": dnsRecordStatus{
+			ObservedGeneration: res.Metadata.Generation,
+			LastSyncTime:       now,
+			Conditions:         []condition{ready},
+		},
+	}
+	err = kube.do(context.TODO(), http.MethodPatch, path+"/"+res.Metadata.Name+"/status",
+		"application/merge-patch+json", patch, nil)
+	if err != nil {
+		logger.Err(err).Msg("unable to update dnsrecord status")
+	}
+}
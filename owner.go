@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"flouret.io/update-route53/pkg/provider"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/rs/zerolog"
+)
+
+// Prefix of the companion TXT record holding the owner of a record
+const ownerRecordPrefix = "_update-route53."
+
+// errNotOwner is returned when a record exists but is not owned by this
+// instance.
+var errNotOwner = errors.New("record is not owned by this instance")
+
+// errProtected is returned when a record is protected from updates.
+var errProtected = errors.New("record holds a value this instance never wrote")
+
+// protectedRecords are the records that existed at startup with values this
+// instance never wrote, keyed by record.Key(). In protect mode
+// (PROTECT_EXISTING), they are not modified.
+var protectedRecords = map[string]bool{}
+
+// checkClaim refuses to modify an existing record owned by someone else or
+// holding a value this instance never wrote. Failures are logged and
+// returned.
+func checkClaim(svc *route53.Client, rec record, logger zerolog.Logger, exists bool) error {
+	if ownerID != "" && exists {
+		owner, err := getRecordOwner(svc, rec)
+		if err != nil {
+			logger.Err(err).Msg("unable to get record owner")
+			return fmt.Errorf("unable to get record owner: %w", err)
+		}
+		if owner != ownerRecordValue() {
+			if !forceOwnership {
+				logger.Error().Str("owner", owner).Msg("record is not owned by this instance, refusing to update")
+				return errNotOwner
+			}
+			logger.Warn().Str("owner", owner).Msg("taking ownership of record")
+		}
+	}
+
+	if protectedRecords[rec.Key()] {
+		logger.Error().Msg("record holds a value this instance never wrote, refusing to update; run with -force to take it over")
+		return errProtected
+	}
+	return nil
+}
+
+// protectRecords marks the records that exist with values this instance never
+// wrote as protected. A record was written by this instance if it holds the
+// value recorded in the state, or if its owner record names this instance.
+func protectRecords(svc *route53.Client, records []record) error {
+	for _, rec := range records {
+		recordSet, err := getRecordSet(svc, rec)
+		if err != nil {
+			return fmt.Errorf("unable to get current record of %s: %w", provider.DisplayName(rec.Name), err)
+		}
+		if recordSet == nil {
+			continue
+		}
+		if own := stateFor(rec).OwnValue; own != "" && slices.Contains(provider.Values(recordSet), own) {
+			continue
+		}
+		if ownerID != "" {
+			owner, err := getRecordOwner(svc, rec)
+			if err != nil {
+				return fmt.Errorf("unable to get owner of %s: %w", provider.DisplayName(rec.Name), err)
+			}
+			if owner == ownerRecordValue() {
+				continue
+			}
+		}
+		logger.Warn().
+			Str("dnsName", provider.DisplayName(rec.Name)).
+			Str("hostedZoneId", rec.HostedZoneId).
+			Str("setIdentifier", rec.SetIdentifier).
+			Strs("recordValues", provider.Values(recordSet)).
+			Msg("record holds a value this instance never wrote, protecting it")
+		protectedRecords[rec.Key()] = true
+	}
+	return nil
+}
+
+// ownerRecordName returns the name of the TXT record holding the owner of
+// the given record.
+func ownerRecordName(rec record) string {
+	return ownerRecordPrefix + rec.Name
+}
+
+// ownerRecordValue returns the TXT value identifying this instance as the
+// owner of a record.
+func ownerRecordValue() string {
+	return fmt.Sprintf(`"owner=update-route53/%s"`, ownerID)
+}
+
+// getRecordOwner returns the TXT value of the owner record of the given
+// record, or an empty string if there is none.
+func getRecordOwner(svc *route53.Client, rec record) (string, error) {
+	recordSet, err := getOwnerRecordSet(svc, rec)
+	return ownerOf(recordSet), err
+}
+
+// getOwnerRecordSet returns the owner record set of the given record, or nil
+// if there is none.
+func getOwnerRecordSet(svc *route53.Client, rec record) (*types.ResourceRecordSet, error) {
+	return provider.New(svc).RecordSet(context.TODO(), rec.HostedZoneId, ownerRecordName(rec), types.RRTypeTxt, rec.SetIdentifier)
+}
+
+// ownerOf returns the TXT value of an owner record set, or an empty string if
+// it is nil.
+func ownerOf(recordSet *types.ResourceRecordSet) string {
+	if recordSet == nil {
+		return ""
+	}
+	values := make([]string, 0, len(recordSet.ResourceRecords))
+	for _, rr := range recordSet.ResourceRecords {
+		values = append(values, aws.ToString(rr.Value))
+	}
+	return strings.Join(values, " ")
+}
+
+// ownerChange returns the change that records this instance as the owner of
+// the given record.
+func ownerChange(rec record) types.Change {
+	recordSet := &types.ResourceRecordSet{
+		Name:            aws.String(ownerRecordName(rec)),
+		Type:            types.RRTypeTxt,
+		TTL:             aws.Int64(int64(rec.TTL)),
+		ResourceRecords: []types.ResourceRecord{{Value: aws.String(ownerRecordValue())}},
+	}
+	rec.ApplyRouting(recordSet, false)
+	return types.Change{
+		Action:            types.ChangeActionUpsert,
+		ResourceRecordSet: recordSet,
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var updatePanics = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "update_route53_panics_total",
+	Help: "Panics recovered in update cycles",
+})
+
+func init() {
+	prometheus.MustRegister(updatePanics)
+}
+
+// updateRecordsRecovered is updateRecords, with panics recovered and
+// returned as errors, so a bug in an update cycle does not take down the
+// process and its health check server.
+func updateRecordsRecovered(svc *route53.Client, records []record) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			updatePanics.Inc()
+			logger.Error().
+				Str("panic", fmt.Sprint(r)).
+				Str("stack", string(debug.Stack())).
+				Msg("recovered from panic in update cycle")
+			err = fmt.Errorf("panic in update cycle: %v", r)
+		}
+	}()
+	return updateRecords(svc, records)
+}
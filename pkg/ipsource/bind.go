@@ -0,0 +1,56 @@
+package ipsource
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Local end of check IP requests, for multi-homed hosts: the address that
+// requests are sent from, and the network interface that they are sent
+// through.
+var (
+	LocalAddress   = ""
+	LocalInterface = ""
+)
+
+var (
+	clientOnce sync.Once
+	client     *http.Client
+)
+
+// httpClient returns the HTTP client of check IP requests, which honors
+// DisableKeepAlives, LocalAddress and LocalInterface. Those are set once at
+// startup, so the client is only built once.
+func httpClient() *http.Client {
+	if !DisableKeepAlives && LocalAddress == "" && LocalInterface == "" {
+		return http.DefaultClient
+	}
+	clientOnce.Do(func() {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.DisableKeepAlives = DisableKeepAlives
+		transport.DialContext = dialContext
+		client = &http.Client{Transport: transport}
+	})
+	return client
+}
+
+// dialContext opens the connections of check IP requests from LocalAddress
+// and through LocalInterface, if set.
+func dialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	if LocalAddress != "" {
+		dialer.LocalAddr = &net.TCPAddr{IP: net.ParseIP(LocalAddress)}
+	}
+	if LocalInterface != "" {
+		if err := bindToInterface(dialer, LocalInterface); err != nil {
+			return nil, err
+		}
+	}
+	return dialer.DialContext(ctx, network, address)
+}
@@ -0,0 +1,27 @@
+package ipsource
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// bindToInterface makes the dialer bind its sockets to the named network
+// interface, so the connections go through it regardless of the routes.
+func bindToInterface(dialer *net.Dialer, name string) error {
+	dialer.Control = func(network, address string, c syscall.RawConn) error {
+		var err error
+		if ctrlErr := c.Control(func(fd uintptr) {
+			err = unix.BindToDevice(int(fd), name)
+		}); ctrlErr != nil {
+			return ctrlErr
+		}
+		if err != nil {
+			return fmt.Errorf("unable to bind to interface %s: %w", name, err)
+		}
+		return nil
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+
+package ipsource
+
+import (
+	"net"
+)
+
+// bindToInterface makes the dialer send from the address of the named network
+// interface, since binding sockets to an interface is only supported on Linux.
+func bindToInterface(dialer *net.Dialer, name string) error {
+	address, err := InterfaceAddress(name)
+	if err != nil {
+		return err
+	}
+	dialer.LocalAddr = &net.TCPAddr{IP: net.ParseIP(address)}
+	return nil
+}
@@ -0,0 +1,108 @@
+package ipsource
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// ECS is the address of the network interface of the ECS task running this
+// process (awsvpc network mode, as on Fargate), read from the task metadata
+// endpoint. If Public is set, it is the public IPv4 address associated with
+// that network interface instead, which is looked up with EC2.
+type ECS struct {
+	Public bool
+}
+
+// EC2 is the client used to look up the public address of ECS tasks. It must
+// be set before an ECS source with Public set is used.
+var EC2 *ec2.Client
+
+// ecsTaskMetadata is the part of the task metadata (version 4) describing the
+// networks of the containers.
+type ecsTaskMetadata struct {
+	Containers []struct {
+		Networks []struct {
+			NetworkMode   string
+			IPv4Addresses []string
+			MACAddress    string
+		}
+	}
+}
+
+// Address implements Source.
+func (e ECS) Address(ctx context.Context) (string, error) {
+	address, mac, err := ecsTaskAddress(ctx)
+	if err != nil || !e.Public {
+		return address, err
+	}
+
+	if EC2 == nil {
+		return "", errors.New("no ec2 client to look up the public address of the task")
+	}
+	output, err := EC2.DescribeNetworkInterfaces(ctx, &ec2.DescribeNetworkInterfacesInput{
+		Filters: []types.Filter{{
+			Name:   aws.String("mac-address"),
+			Values: []string{mac},
+		}},
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to describe network interface of the task: %w", err)
+	}
+	for _, eni := range output.NetworkInterfaces {
+		if eni.Association != nil && aws.ToString(eni.Association.PublicIp) != "" {
+			return aws.ToString(eni.Association.PublicIp), nil
+		}
+	}
+	return "", errors.New("task has no public ipv4 address")
+}
+
+// String implements Source.
+func (e ECS) String() string {
+	if e.Public {
+		return "ecs://public"
+	}
+	return "ecs://"
+}
+
+// ecsTaskAddress returns the IPv4 address and the MAC address of the network
+// interface of the task, from the task metadata endpoint.
+func ecsTaskAddress(ctx context.Context) (string, string, error) {
+	endpoint := os.Getenv("ECS_CONTAINER_METADATA_URI_V4")
+	if endpoint == "" {
+		return "", "", errors.New("not running in an ecs task (ECS_CONTAINER_METADATA_URI_V4 is not set)")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"/task", nil)
+	if err != nil {
+		return "", "", fmt.Errorf("unable to read task metadata: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", "", fmt.Errorf("unable to read task metadata: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("unable to read task metadata: %s", resp.Status)
+	}
+
+	var metadata ecsTaskMetadata
+	if err := json.NewDecoder(resp.Body).Decode(&metadata); err != nil {
+		return "", "", fmt.Errorf("unable to parse task metadata: %w", err)
+	}
+	for _, container := range metadata.Containers {
+		for _, network := range container.Networks {
+			if network.NetworkMode == "awsvpc" && len(network.IPv4Addresses) > 0 {
+				return network.IPv4Addresses[0], network.MACAddress, nil
+			}
+		}
+	}
+	return "", "", errors.New("task has no awsvpc network interface")
+}
@@ -0,0 +1,201 @@
+package ipsource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Failover tries each of its sources in order until one returns an address.
+// Each source has a circuit breaker: after BreakerThreshold consecutive
+// failures, it is skipped for BreakerCooldown, then a single probe is allowed
+// to close the circuit again. Sources with an open circuit are still tried as
+// a last resort, if all the others failed. With AdaptiveOrder, the sources are
+// tried from the fastest and most reliable instead of in order.
+type Failover []Source
+
+// Circuit breaker settings of the sources of a Failover. A BreakerThreshold
+// of zero disables the circuit breakers.
+var (
+	BreakerThreshold = 3
+	BreakerCooldown  = 5 * time.Minute
+)
+
+// AdaptiveOrder makes a Failover try its sources by increasing expected
+// latency, that is their average latency divided by their success rate,
+// instead of in order. Sources that have not been tried yet come first, in
+// order, so that all of them get measured.
+var AdaptiveOrder = false
+
+// Observer, if set, is called with the outcome of each attempt of a source
+// of a Failover.
+var Observer func(source Source, latency time.Duration, err error)
+
+// healthDecay is the weight of the latest attempt in the averages of the
+// latency and success rate of a source.
+const healthDecay = 0.2
+
+// Address implements Source.
+func (f Failover) Address(ctx context.Context) (string, error) {
+	var errs []error
+	var skipped []Source
+	for _, source := range f.ordered() {
+		if !healthOf(source).allow() {
+			skipped = append(skipped, source)
+			continue
+		}
+		address, err := tryAddress(ctx, source)
+		if err == nil {
+			return address, nil
+		}
+		errs = append(errs, err)
+	}
+
+	for _, source := range skipped {
+		address, err := tryAddress(ctx, source)
+		if err == nil {
+			return address, nil
+		}
+		errs = append(errs, err)
+	}
+	return "", errors.Join(errs...)
+}
+
+// String implements Source.
+func (f Failover) String() string {
+	specs := make([]string, len(f))
+	for i, source := range f {
+		specs[i] = source.String()
+	}
+	return strings.Join(specs, ",")
+}
+
+// ordered returns the sources in the order they should be tried.
+func (f Failover) ordered() []Source {
+	if !AdaptiveOrder {
+		return f
+	}
+	costs := map[Source]float64{}
+	for _, source := range f {
+		costs[source] = healthOf(source).cost()
+	}
+	sources := slices.Clone(f)
+	slices.SortStableFunc(sources, func(a, b Source) int {
+		switch {
+		case costs[a] < costs[b]:
+			return -1
+		case costs[a] > costs[b]:
+			return 1
+		}
+		return 0
+	})
+	return sources
+}
+
+// tryAddress returns the address of a source of a Failover, recording the
+// result in its health. An attempt that times out is a failure.
+func tryAddress(ctx context.Context, source Source) (string, error) {
+	start := time.Now()
+	address, err := Attempt(ctx, source)
+	latency := time.Since(start)
+	healthOf(source).record(latency, err)
+	if Observer != nil {
+		Observer(source, latency, err)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", source, err)
+	}
+	return address, nil
+}
+
+// health is the circuit breaker and the measurements of a source.
+type health struct {
+	mu        sync.Mutex
+	failures  int       // Consecutive failures
+	openUntil time.Time // End of the cooldown, once open
+	probing   bool      // Whether a half-open probe is in flight
+
+	attempts int     // Number of attempts
+	latency  float64 // Moving average of the latency, in seconds
+	success  float64 // Moving average of the success rate
+}
+
+var (
+	healthsMu sync.Mutex
+	healths   = map[string]*health{}
+)
+
+// healthOf returns the health of a source, which persists across cycles.
+func healthOf(source Source) *health {
+	healthsMu.Lock()
+	defer healthsMu.Unlock()
+	h := healths[source.String()]
+	if h == nil {
+		h = &health{}
+		healths[source.String()] = h
+	}
+	return h
+}
+
+// allow reports whether the source may be tried: always while the circuit is
+// closed, never during the cooldown, and for a single probe after it.
+func (h *health) allow() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	switch {
+	case BreakerThreshold <= 0 || h.failures < BreakerThreshold:
+		return true
+	case time.Now().Before(h.openUntil) || h.probing:
+		return false
+	}
+	h.probing = true
+	return true
+}
+
+// cost returns the expected latency of the source, in seconds: zero if it
+// has not been tried yet, and infinite if it never succeeded recently.
+func (h *health) cost() float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	switch {
+	case h.attempts == 0:
+		return 0
+	case h.success == 0:
+		return math.Inf(1)
+	}
+	return h.latency / h.success
+}
+
+// record updates the circuit and the measurements with the result of an
+// attempt.
+func (h *health) record(latency time.Duration, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	success := 0.0
+	if err == nil {
+		success = 1
+	}
+	if h.attempts == 0 {
+		h.latency, h.success = latency.Seconds(), success
+	} else {
+		h.latency += healthDecay * (latency.Seconds() - h.latency)
+		h.success += healthDecay * (success - h.success)
+	}
+	h.attempts++
+
+	h.probing = false
+	if err == nil {
+		h.failures = 0
+		return
+	}
+	h.failures++
+	if BreakerThreshold > 0 && h.failures >= BreakerThreshold {
+		h.openUntil = time.Now().Add(BreakerCooldown)
+	}
+}
@@ -0,0 +1,90 @@
+package ipsource
+
+import (
+	"crypto/sha1"
+	"encoding"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// WithInterfaceID returns the IPv6 address with its last 64 bits replaced by
+// the interface identifier described by spec:
+//
+//   - "eui64:<mac>", the modified EUI-64 identifier derived from a MAC address
+//     (RFC 4291), as used by SLAAC without privacy extensions;
+//   - "stable:<secret>[@<mac>]", the stable identifier (RFC 7217) that Linux
+//     derives from the prefix, the stable_secret of the interface and its
+//     permanent MAC address (omitted for interfaces with a random MAC).
+func WithInterfaceID(addr netip.Addr, spec string) (netip.Addr, error) {
+	if !addr.Is6() || addr.Is4In6() {
+		return netip.Addr{}, fmt.Errorf("address %s is not an ipv6 address", addr)
+	}
+	b := addr.As16()
+
+	kind, value, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "eui64":
+		mac, err := net.ParseMAC(value)
+		if err != nil || (len(mac) != 6 && len(mac) != 8) {
+			return netip.Addr{}, fmt.Errorf("invalid mac address in interface id %q", spec)
+		}
+		if len(mac) == 6 {
+			mac = net.HardwareAddr{mac[0], mac[1], mac[2], 0xff, 0xfe, mac[3], mac[4], mac[5]}
+		}
+		copy(b[8:], mac)
+		b[8] ^= 0x02 // Universal/local bit
+	case "stable":
+		secretStr, macStr, hasMAC := strings.Cut(value, "@")
+		secret, err := netip.ParseAddr(secretStr)
+		if err != nil || !secret.Is6() {
+			return netip.Addr{}, fmt.Errorf("invalid secret in interface id %q", spec)
+		}
+		var mac net.HardwareAddr
+		if hasMAC {
+			if mac, err = net.ParseMAC(macStr); err != nil {
+				return netip.Addr{}, fmt.Errorf("invalid mac address in interface id %q", spec)
+			}
+		}
+		iid := stableInterfaceID(secret.As16(), b, mac)
+		copy(b[8:], iid[:])
+	default:
+		return netip.Addr{}, fmt.Errorf("invalid interface id %q", spec)
+	}
+	return netip.AddrFrom16(b), nil
+}
+
+// stableInterfaceID returns the interface identifier that Linux generates for
+// the /64 prefix of addr with addr_gen_mode stable_secret: the first 64 bits
+// of a single SHA-1 block transform of the secret, the prefix, the permanent
+// hardware address and the DAD counter (zero), as stored by little-endian
+// hosts.
+//
+// The kernel runs the bare transform (sha1_transform), without the padding
+// and length of a complete SHA-1 hash, which crypto/sha1 does not expose. But
+// writing exactly one block runs the transform, and the marshaled state of
+// the hash starts with the resulting chaining values.
+func stableInterfaceID(secret, addr [16]byte, mac net.HardwareAddr) [8]byte {
+	var data [sha1.BlockSize]byte
+	copy(data[0:16], secret[:])
+	copy(data[16:24], addr[:8])
+	copy(data[24:56], mac) // Up to 32 bytes, zero padded
+
+	h := sha1.New()
+	h.Write(data[:])
+	state, err := h.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil || !strings.HasPrefix(string(state), sha1StateMagic) {
+		panic("unexpected sha1 state")
+	}
+	state = state[len(sha1StateMagic):]
+
+	var iid [8]byte
+	binary.LittleEndian.PutUint32(iid[0:4], binary.BigEndian.Uint32(state[0:4]))
+	binary.LittleEndian.PutUint32(iid[4:8], binary.BigEndian.Uint32(state[4:8]))
+	return iid
+}
+
+// sha1StateMagic prefixes the marshaled state of a crypto/sha1 hash.
+const sha1StateMagic = "sha\x01"
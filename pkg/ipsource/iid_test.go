@@ -0,0 +1,42 @@
+package ipsource
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestWithInterfaceID(t *testing.T) {
+	tests := []struct {
+		addr string
+		spec string
+		want string
+	}{
+		// Modified EUI-64 (RFC 4291, appendix A)
+		{"2001:db8::1", "eui64:52:54:00:12:34:56", "2001:db8::5054:ff:fe12:3456"},
+		{"2001:db8::1", "eui64:02:11:22:ff:fe:33:44:55", "2001:db8::11:22ff:fe33:4455"},
+		// Generated by Linux 6.18 on a veth interface (random mac) with
+		// stable_secret 2001:db8:1:2:3:4:5:6 and addr_gen_mode 2
+		{"fe80::1", "stable:2001:db8:1:2:3:4:5:6", "fe80::ff05:eb87:4e94:b3ad"},
+	}
+	for _, tt := range tests {
+		got, err := WithInterfaceID(netip.MustParseAddr(tt.addr), tt.spec)
+		if err != nil {
+			t.Errorf("WithInterfaceID(%s, %q): %v", tt.addr, tt.spec, err)
+			continue
+		}
+		if got != netip.MustParseAddr(tt.want) {
+			t.Errorf("WithInterfaceID(%s, %q) = %s, want %s", tt.addr, tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestWithInterfaceIDInvalid(t *testing.T) {
+	for _, spec := range []string{"", "eui64:", "eui64:52:54:00", "stable:192.0.2.1", "random:1"} {
+		if _, err := WithInterfaceID(netip.MustParseAddr("2001:db8::1"), spec); err == nil {
+			t.Errorf("WithInterfaceID(%q): expected an error", spec)
+		}
+	}
+	if _, err := WithInterfaceID(netip.MustParseAddr("192.0.2.1"), "eui64:52:54:00:12:34:56"); err == nil {
+		t.Errorf("WithInterfaceID(192.0.2.1): expected an error")
+	}
+}
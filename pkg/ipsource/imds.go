@@ -0,0 +1,84 @@
+package ipsource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// IMDS is the public IPv4 address of the EC2 instance, read from the instance
+// metadata service (IMDSv2) without any external request. If IPv6 is set, it
+// is the IPv6 address of the instance instead.
+type IMDS struct {
+	IPv6 bool
+}
+
+var (
+	imdsOnce   sync.Once
+	imdsClient *imds.Client
+)
+
+// Address implements Source.
+func (m IMDS) Address(ctx context.Context) (string, error) {
+	imdsOnce.Do(func() {
+		imdsClient = imds.New(imds.Options{})
+	})
+
+	path, missing := "public-ipv4", "instance has no public ipv4 address"
+	if m.IPv6 {
+		path, missing = "ipv6", "instance has no ipv6 address"
+	}
+	output, err := imdsClient.GetMetadata(ctx, &imds.GetMetadataInput{Path: path})
+	if err != nil {
+		var respErr *smithyhttp.ResponseError
+		if errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusNotFound {
+			return "", errors.New(missing)
+		}
+		return "", fmt.Errorf("unable to read instance metadata: %w", err)
+	}
+	defer output.Content.Close()
+
+	body, err := io.ReadAll(io.LimitReader(output.Content, MaxResponseSize))
+	if err != nil {
+		return "", fmt.Errorf("unable to read instance metadata: %w", err)
+	}
+
+	// Validate IP address
+	ipstr := strings.TrimSpace(string(body))
+	if net.ParseIP(ipstr) == nil {
+		return "", fmt.Errorf("unable to parse address %q", ipstr)
+	}
+	return ipstr, nil
+}
+
+// String implements Source.
+func (m IMDS) String() string {
+	if m.IPv6 {
+		return "imds://ipv6"
+	}
+	return "imds://"
+}
+
+// ForIPv6 returns the source with its IMDS sources, including those of a
+// failover, reading the IPv6 address of the instance, for AAAA records.
+func ForIPv6(source Source) Source {
+	switch source := source.(type) {
+	case IMDS:
+		return IMDS{IPv6: true}
+	case Failover:
+		sources := make(Failover, len(source))
+		for i, s := range source {
+			sources[i] = ForIPv6(s)
+		}
+		return sources
+	}
+	return source
+}
@@ -0,0 +1,242 @@
+// Package ipsource detects the address that a DNS record should hold.
+package ipsource
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Source is where the address of a record is detected from.
+type Source interface {
+	// Address returns the current address.
+	Address(ctx context.Context) (string, error)
+
+	// String returns the source in the form accepted by Parse.
+	String() string
+}
+
+// Static is a fixed address, which bypasses detection.
+type Static string
+
+// Address implements Source.
+func (s Static) Address(ctx context.Context) (string, error) {
+	return string(s), nil
+}
+
+// String implements Source.
+func (s Static) String() string {
+	return "static:" + string(s)
+}
+
+// Interface is the first global unicast IPv4 address of a network interface.
+type Interface string
+
+// Address implements Source.
+func (i Interface) Address(ctx context.Context) (string, error) {
+	return InterfaceAddress(string(i))
+}
+
+// String implements Source.
+func (i Interface) String() string {
+	return "interface:" + string(i)
+}
+
+// HTTP is a check IP service that returns the address of the caller in the
+// response body.
+type HTTP string
+
+// Address implements Source.
+func (h HTTP) Address(ctx context.Context) (string, error) {
+	return Fetch(ctx, string(h))
+}
+
+// String implements Source.
+func (h HTTP) String() string {
+	return string(h)
+}
+
+// Timeout is how long a single attempt of a source may take, so that a source
+// that hangs fails instead of stalling the detection.
+var Timeout = 30 * time.Second
+
+// Attempt returns the address of the source, giving up after Timeout.
+func Attempt(ctx context.Context, source Source) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+	return source.Address(ctx)
+}
+
+// Exec is a program that prints the address on its standard output.
+type Exec string
+
+// ExecTimeout is how long an Exec source may run, unless the context has an
+// earlier deadline.
+var ExecTimeout = 30 * time.Second
+
+// Address implements Source.
+func (e Exec) Address(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, ExecTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, string(e))
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s failed: %w: %s", e, err, msg)
+		}
+		return "", fmt.Errorf("%s failed: %w", e, err)
+	}
+
+	// Validate IP address
+	ipstr, _, _ := strings.Cut(strings.TrimSpace(stdout.String()), "\n")
+	ipstr = strings.TrimSpace(ipstr)
+	if net.ParseIP(ipstr) == nil {
+		return "", fmt.Errorf("unable to parse address %q", ipstr)
+	}
+	return ipstr, nil
+}
+
+// String implements Source.
+func (e Exec) String() string {
+	return "exec://" + string(e)
+}
+
+// Parse returns the source described by "interface:<name>",
+// "interface6:<name>", "static:<address>", "exec://<program>", "imds://",
+// "imds://ipv6", "ecs://", "ecs://public", "tailscale://[<socket>]" or the URL of a check IP
+// service, or a Failover of such sources separated by commas.
+func Parse(spec string) (Source, error) {
+	if strings.Contains(spec, ",") {
+		var failover Failover
+		for _, s := range strings.Split(spec, ",") {
+			source, err := Parse(strings.TrimSpace(s))
+			if err != nil {
+				return nil, err
+			}
+			failover = append(failover, source)
+		}
+		return failover, nil
+	}
+
+	switch {
+	case spec == "imds://" || spec == "imds://ipv6":
+		return IMDS{IPv6: spec == "imds://ipv6"}, nil
+	case spec == "ecs://" || spec == "ecs://public":
+		return ECS{Public: spec == "ecs://public"}, nil
+	case strings.HasPrefix(spec, "tailscale://"):
+		socket := strings.TrimPrefix(spec, "tailscale://")
+		if socket != "" && !filepath.IsAbs(socket) {
+			return nil, fmt.Errorf("socket of source %q must be an absolute path", spec)
+		}
+		return Tailscale(socket), nil
+	case strings.HasPrefix(spec, "exec://"):
+		program := strings.TrimPrefix(spec, "exec://")
+		if !filepath.IsAbs(program) {
+			return nil, fmt.Errorf("program of source %q must be an absolute path", spec)
+		}
+		return Exec(program), nil
+	case strings.HasPrefix(spec, "interface:"):
+		name := strings.TrimPrefix(spec, "interface:")
+		if name == "" {
+			return nil, fmt.Errorf("missing interface name in source %q", spec)
+		}
+		return Interface(name), nil
+	case strings.HasPrefix(spec, "interface6:"):
+		name := strings.TrimPrefix(spec, "interface6:")
+		if name == "" {
+			return nil, fmt.Errorf("missing interface name in source %q", spec)
+		}
+		return Interface6(name), nil
+	case strings.HasPrefix(spec, "static:"):
+		address := strings.TrimPrefix(spec, "static:")
+		if net.ParseIP(address) == nil {
+			return nil, fmt.Errorf("invalid address in source %q", spec)
+		}
+		return Static(address), nil
+	default:
+		u, err := url.Parse(spec)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("invalid source %q", spec)
+		}
+		return HTTP(spec), nil
+	}
+}
+
+// InterfaceAddress returns the first global unicast IPv4 address assigned to
+// the named network interface.
+func InterfaceAddress(name string) (string, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return "", fmt.Errorf("unable to find interface: %w", err)
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return "", fmt.Errorf("unable to get interface addresses: %w", err)
+	}
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if ip := ipnet.IP.To4(); ip != nil && ip.IsGlobalUnicast() {
+			return ip.String(), nil
+		}
+	}
+	return "", fmt.Errorf("no ipv4 address found on interface %s", name)
+}
+
+// DisableKeepAlives makes Fetch open a new connection for every request,
+// instead of reusing connections. Some carrier-grade NATs map reused
+// connections to a stale address, which the check IP service would reflect.
+var DisableKeepAlives = false
+
+// MaxResponseSize is the maximum size of the response body of a check IP
+// service, which is a single line holding an address.
+const MaxResponseSize = 256
+
+// Fetch fetches the public IP address from a check IP service that returns
+// the address of the caller in the response body, on a single line of at
+// most MaxResponseSize bytes.
+func Fetch(ctx context.Context, checkIPURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, checkIPURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("unable to fetch current address: %w", err)
+	}
+	req.Close = DisableKeepAlives
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		return "", fmt.Errorf("unable to fetch current address: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Read one byte more than allowed, to tell a response that is too large
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MaxResponseSize+1))
+	if err != nil {
+		return "", fmt.Errorf("unable to read response body: %w", err)
+	}
+	if len(body) > MaxResponseSize {
+		return "", fmt.Errorf("response body of %s is larger than %d bytes", checkIPURL, MaxResponseSize)
+	}
+
+	// Validate IP address
+	ipstr := strings.TrimSpace(string(body))
+	if strings.ContainsAny(ipstr, "\r\n") {
+		return "", fmt.Errorf("response body of %s has more than one line", checkIPURL)
+	}
+	if net.ParseIP(ipstr) == nil {
+		return "", fmt.Errorf("unable to parse address %q", ipstr)
+	}
+	return ipstr, nil
+}
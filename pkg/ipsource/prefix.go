@@ -0,0 +1,71 @@
+package ipsource
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+)
+
+// Interface6 is the first global unicast IPv6 address of a network interface,
+// excluding unique local addresses.
+type Interface6 string
+
+// Address implements Source.
+func (i Interface6) Address(ctx context.Context) (string, error) {
+	return InterfaceAddress6(string(i))
+}
+
+// String implements Source.
+func (i Interface6) String() string {
+	return "interface6:" + string(i)
+}
+
+// InterfaceAddress6 returns the first global unicast IPv6 address assigned to
+// the named network interface, excluding unique local addresses.
+func InterfaceAddress6(name string) (string, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return "", fmt.Errorf("unable to find interface: %w", err)
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return "", fmt.Errorf("unable to get interface addresses: %w", err)
+	}
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok || ipnet.IP.To4() != nil {
+			continue
+		}
+		if ip := ipnet.IP; ip.IsGlobalUnicast() && !ip.IsPrivate() {
+			return ip.String(), nil
+		}
+	}
+	return "", fmt.Errorf("no ipv6 address found on interface %s", name)
+}
+
+// WithSuffix returns the address made of the first bits of prefix, such as a
+// delegated prefix, followed by the remaining bits of suffix, such as the
+// stable interface identifier of a host.
+func WithSuffix(prefix netip.Addr, bits int, suffix netip.Addr) (netip.Addr, error) {
+	if prefix.BitLen() != suffix.BitLen() {
+		return netip.Addr{}, fmt.Errorf("address %s and suffix %s are not of the same family", prefix, suffix)
+	}
+	if bits < 0 || bits > prefix.BitLen() {
+		return netip.Addr{}, fmt.Errorf("invalid prefix length %d", bits)
+	}
+
+	p, s := prefix.As16(), suffix.As16()
+	offset := 128 - prefix.BitLen() // IPv4 addresses are in the last 4 bytes
+	for i := range p {
+		kept := min(max(offset+bits-i*8, 0), 8) // Bits of this byte from prefix
+		mask := byte(0xff << (8 - kept))
+		p[i] = p[i]&mask | s[i]&^mask
+	}
+	addr := netip.AddrFrom16(p)
+	if prefix.Is4() {
+		addr = addr.Unmap()
+	}
+	return addr, nil
+}
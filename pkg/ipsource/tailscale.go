@@ -0,0 +1,79 @@
+package ipsource
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// Tailscale is the Tailscale IPv4 address of the host, read from the local
+// API of tailscaled on the given unix socket, or on the default socket if
+// empty.
+type Tailscale string
+
+// defaultTailscaleSocket is where tailscaled listens for local API requests
+// by default on Linux.
+const defaultTailscaleSocket = "/var/run/tailscale/tailscaled.sock"
+
+// tailscaleStatus is the part of the status of tailscaled describing this
+// host.
+type tailscaleStatus struct {
+	BackendState string
+	Self         struct {
+		TailscaleIPs []string
+	}
+}
+
+// Address implements Source.
+func (t Tailscale) Address(ctx context.Context) (string, error) {
+	socket := string(t)
+	if socket == "" {
+		socket = defaultTailscaleSocket
+	}
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", socket)
+			},
+			DisableKeepAlives: true,
+		},
+	}
+
+	// The host name is required by the local API, which is only reachable
+	// through the socket
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://local-tailscaled.sock/localapi/v0/status", nil)
+	if err != nil {
+		return "", fmt.Errorf("unable to get tailscale status: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("unable to get tailscale status: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unable to get tailscale status: %s", resp.Status)
+	}
+
+	var status tailscaleStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return "", fmt.Errorf("unable to parse tailscale status: %w", err)
+	}
+	if status.BackendState != "Running" {
+		return "", fmt.Errorf("tailscale is not running (%s)", status.BackendState)
+	}
+	for _, ipstr := range status.Self.TailscaleIPs {
+		if ip := net.ParseIP(ipstr); ip != nil && ip.To4() != nil {
+			return ip.String(), nil
+		}
+	}
+	return "", errors.New("no tailscale ipv4 address")
+}
+
+// String implements Source.
+func (t Tailscale) String() string {
+	return "tailscale://" + string(t)
+}
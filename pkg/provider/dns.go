@@ -0,0 +1,179 @@
+package provider
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// authoritativeNameservers caches the nameservers of the zone of each name
+var authoritativeNameservers = map[string][]string{}
+
+// LookupA returns the sorted values and TTL of the A record of the given
+// name by querying the authoritative nameservers of its zone directly,
+// without using the Route53 API. No values are returned if the record does
+// not exist.
+func LookupA(name string) ([]string, uint64, error) {
+	return lookupAddresses(name, dnsmessage.TypeA)
+}
+
+// LookupAAAA is LookupA for the AAAA record of the given name.
+func LookupAAAA(name string) ([]string, uint64, error) {
+	return lookupAddresses(name, dnsmessage.TypeAAAA)
+}
+
+// lookupAddresses returns the sorted values and TTL of the A or AAAA record
+// of the given name from one of the authoritative nameservers of its zone.
+func lookupAddresses(name string, qtype dnsmessage.Type) ([]string, uint64, error) {
+	nameservers, err := findNameservers(name)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var errs []error
+	for _, i := range rand.Perm(len(nameservers)) {
+		values, ttl, err := queryAddresses(nameservers[i], name, qtype)
+		if err == nil {
+			return values, ttl, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", nameservers[i], err))
+	}
+	return nil, 0, errors.Join(errs...)
+}
+
+// findNameservers returns the nameservers of the closest enclosing zone of
+// name that has NS records.
+func findNameservers(name string) ([]string, error) {
+	if nameservers, ok := authoritativeNameservers[name]; ok {
+		return nameservers, nil
+	}
+
+	for zone := name; zone != ""; {
+		records, err := net.LookupNS(zone)
+		if err == nil && len(records) > 0 {
+			nameservers := make([]string, 0, len(records))
+			for _, ns := range records {
+				nameservers = append(nameservers, ns.Host)
+			}
+			authoritativeNameservers[name] = nameservers
+			return nameservers, nil
+		}
+
+		// Try the parent domain
+		_, zone, _ = strings.Cut(zone, ".")
+	}
+	return nil, fmt.Errorf("unable to find nameservers for %s", name)
+}
+
+// queryAddresses queries the given nameserver for the A or AAAA record of
+// name.
+func queryAddresses(nameserver, name string, qtype dnsmessage.Type) ([]string, uint64, error) {
+	qname, err := dnsmessage.NewName(strings.TrimSuffix(name, ".") + ".")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	id := uint16(rand.Uint32())
+	query := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: id},
+		Questions: []dnsmessage.Question{{
+			Name:  qname,
+			Type:  qtype,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+	packet, err := query.Pack()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	resp, err := exchange("udp", nameserver, packet)
+	if err == nil && resp.Header.ID == id && resp.Header.Truncated {
+		// The answer does not fit in a UDP message, retry over TCP
+		resp, err = exchange("tcp", nameserver, packet)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.Header.ID != id {
+		return nil, 0, errors.New("mismatched dns response id")
+	}
+
+	switch resp.Header.RCode {
+	case dnsmessage.RCodeSuccess:
+	case dnsmessage.RCodeNameError:
+		return nil, 0, nil
+	default:
+		return nil, 0, fmt.Errorf("dns query failed: %s", resp.Header.RCode)
+	}
+	if !resp.Header.Authoritative {
+		return nil, 0, errors.New("dns response is not authoritative")
+	}
+
+	var values []string
+	var ttl uint64
+	for _, answer := range resp.Answers {
+		switch body := answer.Body.(type) {
+		case *dnsmessage.AResource:
+			values = append(values, netip.AddrFrom4(body.A).String())
+		case *dnsmessage.AAAAResource:
+			values = append(values, netip.AddrFrom16(body.AAAA).String())
+		default:
+			continue
+		}
+		ttl = uint64(answer.Header.TTL)
+	}
+	slices.Sort(values)
+	return values, ttl, nil
+}
+
+// exchange sends a DNS query to the nameserver over UDP or TCP and reads the
+// response, with the length prefix of TCP messages.
+func exchange(network, nameserver string, packet []byte) (*dnsmessage.Message, error) {
+	conn, err := net.DialTimeout(network, net.JoinHostPort(nameserver, "53"), 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	var buf []byte
+	if network == "tcp" {
+		if _, err := conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(packet))), packet...)); err != nil {
+			return nil, err
+		}
+		var length [2]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return nil, err
+		}
+		buf = make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err := conn.Write(packet); err != nil {
+			return nil, err
+		}
+		buf = make([]byte, 4096)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		buf = buf[:n]
+	}
+
+	var resp dnsmessage.Message
+	if err := resp.Unpack(buf); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
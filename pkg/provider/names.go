@@ -0,0 +1,104 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// idnaProfile converts internationalized names for Route53. Underscores and
+// asterisks are allowed, for service and wildcard records.
+var idnaProfile = idna.New(idna.MapForLookup(), idna.StrictDomainName(false))
+
+// ASCIIName returns the ASCII (punycode) form of a DNS name, which is the
+// form Route53 expects.
+func ASCIIName(name string) (string, error) {
+	return idnaProfile.ToASCII(name)
+}
+
+// DisplayName returns the Unicode form of a DNS name, for logs.
+func DisplayName(name string) string {
+	if unicode, err := idna.Display.ToUnicode(name); err == nil {
+		return unicode
+	}
+	return name
+}
+
+// EscapeName returns a DNS name in the form used by Route53 in
+// ListResourceRecordSets, where the asterisk of wildcard names is escaped as
+// \052.
+func EscapeName(name string) string {
+	return strings.ReplaceAll(name, "*", `\052`)
+}
+
+// UnescapeName decodes the \ooo octal escapes used by Route53 in record
+// names, such as \052 for the asterisk of wildcard names.
+func UnescapeName(name string) string {
+	if !strings.Contains(name, `\`) {
+		return name
+	}
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] == '\\' && i+4 <= len(name) {
+			if c, err := strconv.ParseUint(name[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(name[i])
+	}
+	return b.String()
+}
+
+// SameName reports whether a record name returned by Route53 is the given
+// name, ignoring case, escapes and the trailing dot.
+func SameName(returned, name string) bool {
+	return strings.EqualFold(
+		strings.TrimSuffix(UnescapeName(returned), "."),
+		strings.TrimSuffix(name, "."))
+}
+
+// NormalizeName validates a DNS name from the configuration and returns it in
+// the form used for Route53: ASCII, lowercase, without the trailing dot.
+// Labels may contain letters, digits, hyphens and underscores, and the first
+// label may be an asterisk for wildcard records.
+func NormalizeName(name string) (string, error) {
+	name, err := ASCIIName(strings.TrimSuffix(name, "."))
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		return "", errors.New("empty name")
+	}
+	if len(name) > 253 {
+		return "", fmt.Errorf("name is longer than 253 characters")
+	}
+
+	for i, label := range strings.Split(name, ".") {
+		if label == "" {
+			return "", errors.New("empty label")
+		}
+		if len(label) > 63 {
+			return "", fmt.Errorf("label %q is longer than 63 characters", label)
+		}
+		if label == "*" {
+			if i > 0 {
+				return "", errors.New("wildcard must be the first label")
+			}
+			continue
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return "", fmt.Errorf("invalid character %q in label %q", c, label)
+			}
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return "", fmt.Errorf("label %q starts or ends with a hyphen", label)
+		}
+	}
+	return name, nil
+}
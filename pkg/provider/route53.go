@@ -0,0 +1,155 @@
+// Package provider reads and changes DNS records in Route53.
+package provider
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+// Limits of a single ChangeResourceRecordSets request. UPSERT changes count
+// twice against the number of resource records.
+const (
+	MaxBatchRecords    = 1000
+	MaxBatchValueChars = 32000
+)
+
+// Route53 reads and changes records of Route53 hosted zones.
+type Route53 struct {
+	Client  *route53.Client
+	Comment string // Comment of the change batches, if set
+}
+
+// New returns a provider using the given Route53 client.
+func New(client *route53.Client) *Route53 {
+	return &Route53{Client: client}
+}
+
+// hostedZonePath returns the path of a hosted zone in the Route53 API.
+func hostedZonePath(zone string) *string {
+	return aws.String("/hostedzone/" + zone)
+}
+
+// RecordSet returns the record set with the given name, type and set
+// identifier (empty for simple records), or nil if it does not exist. Record
+// sets are listed in order starting at the name, type and set identifier, so
+// the first result is the record if it exists and a single item is enough
+// regardless of the size of the zone.
+func (p *Route53) RecordSet(ctx context.Context, zone, name string, recordType types.RRType, setIdentifier string) (*types.ResourceRecordSet, error) {
+	input := &route53.ListResourceRecordSetsInput{
+		HostedZoneId:    hostedZonePath(zone),
+		StartRecordName: aws.String(EscapeName(name)),
+		StartRecordType: recordType,
+		MaxItems:        aws.Int32(1),
+	}
+	if setIdentifier != "" {
+		input.StartRecordIdentifier = aws.String(setIdentifier)
+	}
+	listOutput, err := p.Client.ListResourceRecordSets(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	for _, recordSet := range listOutput.ResourceRecordSets {
+		if SameName(*recordSet.Name, name) &&
+			recordSet.Type == recordType &&
+			aws.ToString(recordSet.SetIdentifier) == setIdentifier {
+			return &recordSet, nil
+		}
+	}
+	return nil, nil
+}
+
+// RecordSets returns all the record sets of the given type in a hosted zone.
+func (p *Route53) RecordSets(ctx context.Context, zone string, recordType types.RRType) ([]types.ResourceRecordSet, error) {
+	var recordSets []types.ResourceRecordSet
+	paginator := route53.NewListResourceRecordSetsPaginator(p.Client, &route53.ListResourceRecordSetsInput{
+		HostedZoneId: hostedZonePath(zone),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, recordSet := range page.ResourceRecordSets {
+			if recordSet.Type == recordType {
+				recordSets = append(recordSets, recordSet)
+			}
+		}
+	}
+	return recordSets, nil
+}
+
+// Change submits changes to a hosted zone and returns the id of the change.
+func (p *Route53) Change(ctx context.Context, zone string, changes []types.Change) (string, error) {
+	batch := &types.ChangeBatch{Changes: changes}
+	if p.Comment != "" {
+		batch.Comment = aws.String(p.Comment)
+	}
+	output, err := p.Client.ChangeResourceRecordSets(ctx, &route53.ChangeResourceRecordSetsInput{
+		ChangeBatch:  batch,
+		HostedZoneId: hostedZonePath(zone),
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(output.ChangeInfo.Id), nil
+}
+
+// WaitForChange polls the status of a change every interval until it is
+// INSYNC.
+func (p *Route53) WaitForChange(ctx context.Context, id string, interval time.Duration) error {
+	for {
+		resp, err := p.Client.GetChange(ctx, &route53.GetChangeInput{
+			Id: aws.String(id),
+		})
+		if err != nil {
+			return err
+		}
+		if resp.ChangeInfo.Status == types.ChangeStatusInsync {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Values returns the sorted values of a record set.
+func Values(recordSet *types.ResourceRecordSet) []string {
+	values := make([]string, 0, len(recordSet.ResourceRecords))
+	for _, rr := range recordSet.ResourceRecords {
+		values = append(values, aws.ToString(rr.Value))
+	}
+	slices.Sort(values)
+	return values
+}
+
+// ResourceRecords converts values to route53 resource records.
+func ResourceRecords(values []string) []types.ResourceRecord {
+	records := make([]types.ResourceRecord, 0, len(values))
+	for _, value := range values {
+		records = append(records, types.ResourceRecord{Value: aws.String(value)})
+	}
+	return records
+}
+
+// ChangeSize returns the number of resource records and value characters a
+// change counts for against the limits of a request.
+func ChangeSize(change types.Change) (int, int) {
+	records, chars := 0, 0
+	for _, rr := range change.ResourceRecordSet.ResourceRecords {
+		records++
+		chars += len(aws.ToString(rr.Value))
+	}
+	if change.Action == types.ChangeActionUpsert {
+		records, chars = records*2, chars*2
+	}
+	return records, chars
+}
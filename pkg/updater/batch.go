@@ -0,0 +1,125 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"flouret.io/update-route53/pkg/provider"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+// splitBatches splits the changes of a hosted zone into batches that fit in
+// a single request.
+func splitBatches(pending []*Change) [][]*Change {
+	var batches [][]*Change
+	var batch []*Change
+	batchRecords, batchChars := 0, 0
+	for _, c := range pending {
+		records, chars := 0, 0
+		for _, change := range c.changes {
+			r, n := provider.ChangeSize(change)
+			records, chars = records+r, chars+n
+		}
+		if len(batch) > 0 && (batchRecords+records > provider.MaxBatchRecords || batchChars+chars > provider.MaxBatchValueChars) {
+			batches = append(batches, batch)
+			batch, batchRecords, batchChars = nil, 0, 0
+		}
+		batch = append(batch, c)
+		batchRecords, batchChars = batchRecords+records, batchChars+chars
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+// batchChanges returns the changes of the given batch. Companion records
+// shared by several records, such as a metadata record, are only changed
+// once.
+func batchChanges(batch []*Change) []types.Change {
+	var changes []types.Change
+	seen := map[string]int{}
+	for _, c := range batch {
+		for _, change := range c.changes {
+			rs := change.ResourceRecordSet
+			key := fmt.Sprintf("%s/%s/%s/%s", change.Action, aws.ToString(rs.Name), rs.Type, aws.ToString(rs.SetIdentifier))
+			if i, ok := seen[key]; ok {
+				changes[i] = change
+				continue
+			}
+			seen[key] = len(changes)
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// newProvider returns the Route53 provider used to submit changes, with the
+// comment of the Comment hook.
+func (u *Updater) newProvider() *provider.Route53 {
+	p := provider.New(u.client)
+	if u.hooks.Comment != nil {
+		p.Comment = u.hooks.Comment()
+	}
+	return p
+}
+
+// submitBatch submits the changes of a batch of records in the given hosted
+// zone, waits until they are INSYNC and finishes the updates. It returns the
+// error of each change.
+func (u *Updater) submitBatch(ctx context.Context, zone string, batch []*Change) map[*Change]error {
+	errs := map[*Change]error{}
+	defer func() {
+		for _, c := range batch {
+			c.release()
+		}
+	}()
+	fail := func(msg string, err error) map[*Change]error {
+		for _, c := range batch {
+			c.Logger.Err(err).Msg(msg)
+			errs[c] = fmt.Errorf("%s: %w", msg, err)
+		}
+		return errs
+	}
+
+	p := u.newProvider()
+	changes := batchChanges(batch)
+	changeId, err := p.Change(ctx, zone, changes)
+	if err != nil {
+		return fail("unable to change record sets", err)
+	}
+	submitted := time.Now()
+	if u.hooks.Submitted != nil {
+		u.hooks.Submitted(zone, changeId, changes, batch)
+	}
+
+	for _, c := range batch {
+		c.ChangeId = changeId
+		c.State.LastChange = submitted
+		c.State.OwnValue = c.Address
+		c.State.DriftValues = nil
+		c.Logger = c.Logger.With().Str("change", changeId).Logger()
+		c.Logger.Info().Int("batchSize", len(batch)).Msg("change submitted")
+	}
+
+	// Wait until the changes are INSYNC, checking every 10 seconds
+	waitCtx, cancel := context.WithTimeout(ctx, u.propagationTimeout)
+	defer cancel()
+	if err := p.WaitForChange(waitCtx, changeId, 10*time.Second); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("%w: %w", ErrPropagationTimeout, err)
+		}
+		return fail("unable to get change status", err)
+	}
+	propagation := time.Since(submitted)
+	u.propagationDuration.Observe(propagation.Seconds())
+
+	for _, c := range batch {
+		c.Propagation = propagation
+		errs[c] = u.finishUpdate(ctx, c)
+	}
+	return errs
+}
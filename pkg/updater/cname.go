@@ -0,0 +1,127 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"flouret.io/update-route53/pkg/provider"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+// readCNAME reads the current target of a record in CNAME mode into its
+// state.
+func (u *Updater) readCNAME(ctx context.Context, rec Record, st *State) error {
+	recordSet, err := u.recordSet(ctx, rec)
+	if err != nil {
+		return err
+	}
+	st.RecordValues, st.RecordTTL = nil, 0
+	if recordSet != nil {
+		st.RecordValues = provider.Values(recordSet)
+		st.RecordTTL = uint64(aws.ToInt64(recordSet.TTL))
+	}
+	st.LastVerified = time.Now()
+	return nil
+}
+
+// pointsAtTarget reports whether the state of a record in CNAME mode holds
+// its target and TTL.
+func pointsAtTarget(rec Record, st *State) bool {
+	current := strings.Join(st.RecordValues, ",")
+	return strings.EqualFold(strings.TrimSuffix(current, "."), strings.TrimSuffix(rec.CNAMETarget, ".")) &&
+		st.RecordTTL == rec.TTL
+}
+
+// updateCNAME runs a single update cycle for a record in CNAME mode, making
+// sure it points at its target. The change is not awaited. It reports
+// whether the record was changed. Failures are logged and returned.
+func (u *Updater) updateCNAME(ctx context.Context, rec Record) (bool, error) {
+	logger := u.recordLogger(rec).With().Str("cnameTarget", rec.CNAMETarget).Logger()
+	st := u.State(rec)
+
+	// Fetch the current target, unless the cached value can be used
+	if u.mustRead(rec, st) {
+		if err := u.readCNAME(ctx, rec, st); err != nil {
+			logger.Err(err).Msg("unable to get current record value")
+			return false, fmt.Errorf("unable to get current record value: %w", err)
+		}
+	}
+
+	// Only maintain the target of records created by someone else
+	if u.requireExisting && len(st.RecordValues) == 0 {
+		logger.Error().Msg("record does not exist, refusing to create it")
+		return false, ErrRecordMissing
+	}
+
+	if pointsAtTarget(rec, st) {
+		logger.WithLevel(u.unchangedLogLevel(rec)).Msg("target has not changed")
+		return false, nil
+	}
+
+	// Check ownership and protection, and lock the record
+	release, err := u.claimRecord(ctx, rec, logger, len(st.RecordValues) > 0)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+
+	// Read the record again under the lock, since another instance may have
+	// changed it since it was read
+	if u.hooks.Lock != nil {
+		if err := u.readCNAME(ctx, rec, st); err != nil {
+			logger.Err(err).Msg("unable to get current record value")
+			return false, fmt.Errorf("unable to get current record value: %w", err)
+		}
+		if pointsAtTarget(rec, st) {
+			logger.Info().Msg("record already points at the target, skipping update")
+			return false, nil
+		}
+	}
+
+	c := &Change{
+		Record:  rec,
+		State:   st,
+		Logger:  logger,
+		Address: rec.CNAMETarget,
+		Current: st.RecordValues,
+		Values:  []string{rec.CNAMETarget},
+	}
+	recordSet := &types.ResourceRecordSet{
+		Name:            aws.String(rec.Name),
+		Type:            types.RRTypeCname,
+		TTL:             aws.Int64(int64(rec.TTL)),
+		ResourceRecords: provider.ResourceRecords(c.Values),
+	}
+	rec.ApplyRouting(recordSet, true)
+	c.changes = []types.Change{{
+		Action:            types.ChangeActionUpsert,
+		ResourceRecordSet: recordSet,
+	}}
+	if u.hooks.Companions != nil {
+		c.changes = append(c.changes, u.hooks.Companions(c)...)
+	}
+	c.ChangeId, err = u.newProvider().Change(ctx, rec.HostedZoneId, c.changes)
+	if err != nil {
+		logger.Err(err).Msg("unable to change record sets")
+		return false, fmt.Errorf("unable to change record sets: %w", err)
+	}
+	if u.hooks.Submitted != nil {
+		u.hooks.Submitted(rec.HostedZoneId, c.ChangeId, c.changes, []*Change{c})
+	}
+
+	st.LastChange = time.Now()
+	st.RecordValues, st.RecordTTL = c.Values, rec.TTL
+	u.resetUnchanged(rec)
+	logger.Info().
+		Str("oldTarget", strings.Join(c.Current, ",")).
+		Str("change", c.ChangeId).
+		Msg("change submitted")
+
+	if u.hooks.Changed != nil {
+		u.hooks.Changed(ctx, c)
+	}
+	return true, nil
+}
@@ -0,0 +1,531 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"flouret.io/update-route53/pkg/ipsource"
+	"flouret.io/update-route53/pkg/provider"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/aws/smithy-go"
+	"github.com/rs/zerolog"
+)
+
+// Change is a change of a record, as passed to the hooks.
+type Change struct {
+	Record  Record
+	State   *State
+	Logger  zerolog.Logger
+	Address string   // Detected address, or target of a CNAME record
+	Current []string // Values of the record before the change
+	Values  []string // Values of the record after the change
+
+	ChangeId    string        // Route53 change id, once submitted
+	Propagation time.Duration // Time until the change was INSYNC
+
+	changes []types.Change // Changes to submit, including companion records
+	release func()         // Releases the lock of the record, if any
+}
+
+// detection is the result of detecting the address of a source.
+type detection struct {
+	address string
+	err     error
+}
+
+// update runs a single update cycle for each of the given records, see
+// Update. It also reports whether a record was changed.
+func (u *Updater) update(ctx context.Context, records []Record) ([]error, bool) {
+	errs := make([]error, len(records))
+	changed := false
+
+	// Records sharing a source only detect it once per cycle
+	u.detections = map[string]detection{}
+	defer func() { u.detections = nil }()
+
+	// Prepare the changes, grouped by hosted zone
+	var zones []string
+	pending := map[string][]*Change{}
+	index := map[*Change]int{}
+	for i, rec := range records {
+		if rec.CNAMETarget != "" {
+			var cnameChanged bool
+			cnameChanged, errs[i] = u.updateCNAME(ctx, rec)
+			changed = changed || cnameChanged
+			continue
+		}
+		c, err := u.prepareUpdate(ctx, rec)
+		if err != nil || c == nil {
+			errs[i] = err
+			continue
+		}
+		if _, ok := pending[rec.HostedZoneId]; !ok {
+			zones = append(zones, rec.HostedZoneId)
+		}
+		pending[rec.HostedZoneId] = append(pending[rec.HostedZoneId], c)
+		index[c] = i
+	}
+
+	// Move the other AAAA records of the zones to the new delegated prefixes,
+	// along with the first update of each zone
+	if u.prefixRewrite {
+		for _, zone := range zones {
+			changes, err := u.rewritePrefixes(ctx, zone, pending[zone], records)
+			if err != nil {
+				u.logger.Err(err).Str("hostedZoneId", zone).Msg("unable to rewrite records to the new prefix")
+				continue
+			}
+			pending[zone][0].changes = append(pending[zone][0].changes, changes...)
+		}
+	}
+
+	for _, zone := range zones {
+		for _, batch := range splitBatches(pending[zone]) {
+			for c, err := range u.submitBatch(ctx, zone, batch) {
+				errs[index[c]] = err
+				changed = changed || c.ChangeId != ""
+			}
+		}
+	}
+
+	for i, rec := range records {
+		u.failed[rec.Key()] = errs[i] != nil
+	}
+	return errs, changed
+}
+
+// recordLogger returns the logger of the update cycle of a record.
+func (u *Updater) recordLogger(rec Record) zerolog.Logger {
+	return u.logger.With().
+		Str("dnsName", provider.DisplayName(rec.Name)).
+		Str("hostedZoneId", rec.HostedZoneId).
+		Str("setIdentifier", rec.SetIdentifier).
+		Logger()
+}
+
+// mustRead reports whether the record must be read from Route53, rather than
+// using its cached values: unless the cached values were verified recently
+// and the last cycle succeeded, or reads are skipped.
+func (u *Updater) mustRead(rec Record, st *State) bool {
+	if len(st.RecordValues) == 0 {
+		return true
+	}
+	if time.Since(st.LastVerified) < u.verifyInterval && !u.failed[rec.Key()] {
+		return false
+	}
+	return u.hooks.SkipRead == nil || !u.hooks.SkipRead()
+}
+
+// prepareUpdate runs the checks of an update cycle for the given record and
+// returns the change to submit, or nil if the record does not need to
+// change. Failures are logged and returned.
+func (u *Updater) prepareUpdate(ctx context.Context, rec Record) (*Change, error) {
+	logger := u.recordLogger(rec)
+	st := u.State(rec)
+
+	// Detect current IP address
+	ipstr, err := u.detectCached(ctx, rec)
+	if err != nil {
+		logger.Err(err).Msg("unable to detect current address")
+		return nil, fmt.Errorf("%w: %w", ErrCheckIP, err)
+	}
+	st.LastAddress = ipstr
+
+	logger = logger.With().Str("currentAddress", ipstr).Logger()
+
+	// Refuse to publish bogon addresses, except private and CGNAT addresses
+	// (such as Tailscale addresses) in private hosted zones
+	addr, _ := netip.ParseAddr(ipstr)
+	reason := ipsource.BogonReason(addr.Unmap())
+	if reason != "" && !u.allowBogon && !((reason == "private" || reason == "cgnat") && rec.PrivateZone) {
+		u.rejectedAddresses.WithLabelValues(reason).Inc()
+		logger.Warn().Str("reason", reason).Msg("refusing to publish bogon address")
+		return nil, fmt.Errorf("refusing to publish %s address %s", reason, ipstr)
+	}
+
+	// Fetch current value of record in AWS Route53, unless the cached value
+	// can be used
+	currentRecordValues, currentRecordTTL := st.RecordValues, st.RecordTTL
+	if u.mustRead(rec, st) {
+		currentRecordValues, currentRecordTTL, err = u.RecordValues(ctx, rec)
+		if errors.Is(err, ErrAliasRecord) {
+			logger.Error().Err(err).Msg("record is an alias, which cannot be compared with the address; replace it with an A record with REPLACE_ALIAS=true")
+			return nil, err
+		}
+		if err != nil {
+			logger.Err(err).Msg("unable to get current record value")
+			return nil, fmt.Errorf("unable to get current record value: %w", err)
+		}
+		st.RecordValues, st.RecordTTL = currentRecordValues, currentRecordTTL
+		st.LastVerified = time.Now()
+		u.checkDrift(logger, rec, st, currentRecordValues)
+	} else {
+		logger.Debug().Msg("using cached record value")
+	}
+
+	// Only maintain the values of records created by someone else
+	if u.requireExisting && len(currentRecordValues) == 0 {
+		logger.Error().Msg("record does not exist, refusing to create it")
+		return nil, ErrRecordMissing
+	}
+
+	logger = logger.With().
+		Strs("currentRecordValues", currentRecordValues).
+		Uint64("currentRecordTTL", currentRecordTTL).Logger()
+
+	// Check if the record set differs from what it should be
+	values := DesiredValues(currentRecordValues, st.OwnValue, ipstr, u.merge)
+	if slices.Equal(currentRecordValues, values) &&
+		currentRecordTTL == rec.TTL &&
+		(!rec.ManageHealthCheck || st.HealthCheckAddress == ipstr) {
+		logger.WithLevel(u.unchangedLogLevel(rec)).Msg("address has not changed")
+		return nil, nil
+	}
+
+	// Leave records changed by someone else as they are, if asked to
+	if u.driftAction == DriftAlert && st.DriftValues != nil {
+		logger.Info().Msg("record was changed by someone else, skipping update")
+		return nil, nil
+	}
+
+	// Require a new address to be observed several times in a row, so
+	// transient addresses are not published
+	if !slices.Contains(currentRecordValues, ipstr) && rec.StaticIP == "" {
+		for i := uint64(1); i < u.confirmations; i++ {
+			time.Sleep(u.confirmationInterval)
+			confirmedAddress, err := u.detect(ctx, rec)
+			if err != nil {
+				logger.Err(err).Msg("unable to confirm current address")
+				return nil, err
+			}
+			if confirmedAddress != ipstr {
+				logger.Warn().
+					Str("confirmedAddress", confirmedAddress).
+					Msg("address not confirmed, skipping update")
+				return nil, nil
+			}
+		}
+	}
+
+	// Throttle consecutive changes of the same record
+	if last := st.LastChange; !last.IsZero() && time.Since(last) < u.minChangeInterval {
+		logger.Warn().
+			Time("lastChange", last).
+			Msg("minimum change interval not elapsed, skipping update")
+		return nil, nil
+	}
+
+	// Check ownership and protection, and lock the record
+	release, err := u.claimRecord(ctx, rec, logger, len(currentRecordValues) > 0)
+	if err != nil {
+		return nil, err
+	}
+	success := false
+	defer func() {
+		if !success {
+			release()
+		}
+	}()
+
+	// Read the record again under the lock, since another instance may have
+	// changed it since it was read
+	if u.hooks.Lock != nil {
+		lockedValues, lockedTTL, err := u.RecordValues(ctx, rec)
+		if err != nil {
+			logger.Err(err).Msg("unable to get current record value")
+			return nil, fmt.Errorf("unable to get current record value: %w", err)
+		}
+		st.RecordValues, st.RecordTTL = lockedValues, lockedTTL
+		st.LastVerified = time.Now()
+		if !slices.Equal(lockedValues, currentRecordValues) || lockedTTL != currentRecordTTL {
+			logger.Info().Strs("lockedRecordValues", lockedValues).Msg("record changed before it was locked")
+			currentRecordValues, currentRecordTTL = lockedValues, lockedTTL
+			values = DesiredValues(currentRecordValues, st.OwnValue, ipstr, u.merge)
+			if slices.Equal(currentRecordValues, values) &&
+				currentRecordTTL == rec.TTL &&
+				(!rec.ManageHealthCheck || st.HealthCheckAddress == ipstr) {
+				logger.Info().Msg("record already holds the address, skipping update")
+				return nil, nil
+			}
+		}
+	}
+
+	if dropped := DroppedValues(currentRecordValues, values); len(dropped) > 0 && !u.merge {
+		logger.Warn().Strs("droppedValues", dropped).Msg("replacing all values of record set")
+	}
+
+	c := &Change{
+		Record:  rec,
+		State:   st,
+		Logger:  logger,
+		Address: ipstr,
+		Current: currentRecordValues,
+		Values:  values,
+		release: release,
+	}
+
+	// Run the hooks that can veto the change, or point the health check of
+	// the record at the new address
+	if u.hooks.BeforeChange != nil {
+		if err := u.hooks.BeforeChange(ctx, c); err != nil {
+			return nil, err
+		}
+	}
+	rec, logger = c.Record, c.Logger
+
+	// Update the record in AWS Route53
+	recordSet := &types.ResourceRecordSet{
+		Name:            aws.String(rec.Name),
+		Type:            rec.RecordType(),
+		TTL:             aws.Int64(int64(rec.TTL)),
+		ResourceRecords: provider.ResourceRecords(values),
+	}
+	rec.ApplyRouting(recordSet, true)
+	c.changes = []types.Change{{
+		Action:            types.ChangeActionUpsert,
+		ResourceRecordSet: recordSet,
+	}}
+	if u.replaceAlias {
+		// Route53 does not allow changing an alias into a plain record in
+		// place, so the alias is deleted in the same change batch
+		existing, err := u.recordSet(ctx, rec)
+		if err != nil {
+			logger.Err(err).Msg("unable to get current record")
+			return nil, fmt.Errorf("unable to get current record: %w", err)
+		}
+		if existing != nil && existing.AliasTarget != nil {
+			logger.Warn().
+				Str("aliasTarget", aws.ToString(existing.AliasTarget.DNSName)).
+				Msg("replacing alias with an A record")
+			c.changes = append([]types.Change{{
+				Action:            types.ChangeActionDelete,
+				ResourceRecordSet: existing,
+			}}, c.changes...)
+		}
+	}
+	if u.hooks.Companions != nil {
+		c.changes = append(c.changes, u.hooks.Companions(c)...)
+	}
+
+	success = true
+	return c, nil
+}
+
+// claimRecord runs the checks that precede a change of the given record, and
+// then locks the record to prevent other instances from changing it
+// concurrently. It returns the function releasing the lock. Failures are
+// logged and returned.
+func (u *Updater) claimRecord(ctx context.Context, rec Record, logger zerolog.Logger, exists bool) (func(), error) {
+	if u.hooks.Check != nil {
+		if err := u.hooks.Check(ctx, rec, logger, exists); err != nil {
+			return nil, err
+		}
+	}
+
+	if u.hooks.Lock == nil {
+		return func() {}, nil
+	}
+	release, err := u.hooks.Lock(ctx, rec)
+	if err != nil {
+		logger.Err(err).Msg("unable to lock record")
+		return nil, err
+	}
+	return release, nil
+}
+
+// finishUpdate confirms a change of a record once it is INSYNC, and runs the
+// Changed hook.
+func (u *Updater) finishUpdate(ctx context.Context, c *Change) error {
+	rec, st, logger := c.Record, c.State, c.Logger
+	u.resetUnchanged(rec)
+
+	// Fetch current value of record again to confirm the change, unless reads
+	// are skipped
+	updatedRecordValues, updatedRecordTTL := c.Values, rec.TTL
+	if u.hooks.SkipRead == nil || !u.hooks.SkipRead() {
+		var err error
+		updatedRecordValues, updatedRecordTTL, err = u.RecordValues(ctx, rec)
+		if err != nil {
+			logger.Err(err).Msg("unable to get updated record value")
+			return fmt.Errorf("unable to get updated record value: %w", err)
+		}
+		st.LastVerified = time.Now()
+	}
+	st.RecordValues, st.RecordTTL = updatedRecordValues, updatedRecordTTL
+
+	logger.Info().
+		Strs("updatedRecordValues", updatedRecordValues).
+		Uint64("updatedRecordTTL", updatedRecordTTL).
+		Float64("propagationSeconds", c.Propagation.Seconds()).
+		Msg("change propagated")
+
+	if u.hooks.Changed != nil {
+		u.hooks.Changed(ctx, c)
+	}
+	return nil
+}
+
+// detectSource returns the address detected from a source. Failover sources
+// time out each of their sources themselves, other sources are timed out by
+// ipsource.Attempt.
+func (u *Updater) detectSource(ctx context.Context, source ipsource.Source) (string, error) {
+	if u.hooks.Detect != nil {
+		return u.hooks.Detect(ctx, source)
+	}
+	if _, failover := source.(ipsource.Failover); failover {
+		return source.Address(ctx)
+	}
+	return ipsource.Attempt(ctx, source)
+}
+
+// detect returns the address that the given record should hold.
+func (u *Updater) detect(ctx context.Context, rec Record) (string, error) {
+	address, err := u.detectSource(ctx, rec.Source())
+	if err != nil {
+		return "", err
+	}
+	return rec.HostAddress(address)
+}
+
+// detectCached is detect, with the detections of the running update cycle
+// reused for records sharing a source.
+func (u *Updater) detectCached(ctx context.Context, rec Record) (string, error) {
+	if rec.StaticIP != "" || u.detections == nil {
+		return u.detect(ctx, rec)
+	}
+	source := rec.Source()
+	d, ok := u.detections[source.String()]
+	if !ok {
+		d.address, d.err = u.detectSource(ctx, source)
+		u.detections[source.String()] = d
+	}
+	if d.err != nil {
+		return "", d.err
+	}
+	return rec.HostAddress(d.address)
+}
+
+// recordSet returns the record set of the given record, or nil if it does
+// not exist.
+func (u *Updater) recordSet(ctx context.Context, rec Record) (*types.ResourceRecordSet, error) {
+	return provider.New(u.client).RecordSet(ctx, rec.HostedZoneId, rec.Name, rec.RecordType(), rec.SetIdentifier)
+}
+
+// RecordValues returns the sorted values and the TTL of the record set of the
+// given record. No values are returned if it does not exist.
+func (u *Updater) RecordValues(ctx context.Context, rec Record) ([]string, uint64, error) {
+	if u.readsFromDNS(ctx, rec) {
+		if rec.IPv6 {
+			return provider.LookupAAAA(rec.Name)
+		}
+		return provider.LookupA(rec.Name)
+	}
+
+	recordSet, err := u.recordSet(ctx, rec)
+	if err != nil || recordSet == nil {
+		return nil, 0, err
+	}
+	if recordSet.AliasTarget != nil {
+		if !u.replaceAlias {
+			return nil, 0, fmt.Errorf("%w to %s", ErrAliasRecord, aws.ToString(recordSet.AliasTarget.DNSName))
+		}
+		// The alias is replaced by the next update, as if it did not exist
+		return nil, 0, nil
+	}
+	return provider.Values(recordSet), uint64(aws.ToInt64(recordSet.TTL)), nil
+}
+
+// readsFromDNS reports whether the current value of the record is read from
+// the authoritative nameservers. Records in private hosted zones are not
+// visible to the public nameservers and are read with the Route53 API.
+func (u *Updater) readsFromDNS(ctx context.Context, rec Record) bool {
+	if !u.dnsLookups || rec.PrivateZone {
+		return false
+	}
+	private, ok := u.privateZones[rec.HostedZoneId]
+	if !ok {
+		private = u.isPrivateZone(ctx, rec.HostedZoneId)
+		u.privateZones[rec.HostedZoneId] = private
+	}
+	return !private
+}
+
+// isPrivateZone reports whether the hosted zone is private. Zones that cannot
+// be read, for example because the IAM policy only grants changes, are
+// assumed to be public.
+func (u *Updater) isPrivateZone(ctx context.Context, zone string) bool {
+	output, err := u.client.GetHostedZone(ctx, &route53.GetHostedZoneInput{
+		Id: aws.String(zone),
+	})
+	if err != nil {
+		var apiErr smithy.APIError
+		if !errors.As(err, &apiErr) || !strings.HasPrefix(apiErr.ErrorCode(), "AccessDenied") {
+			u.logger.Warn().Err(err).Str("hostedZoneId", zone).Msg("unable to get hosted zone, assuming it is public")
+		}
+		return false
+	}
+	return output.HostedZone.Config != nil && output.HostedZone.Config.PrivateZone
+}
+
+// drifted reports whether the values read from Route53 no longer hold what
+// this updater last wrote: its value when merging values, and only that
+// value otherwise. Records never written by this updater, or whose state was
+// lost, do not drift.
+func (u *Updater) drifted(st *State, values []string) bool {
+	if st.OwnValue == "" {
+		return false
+	}
+	if u.merge {
+		return !slices.Contains(values, st.OwnValue)
+	}
+	return !slices.Equal(values, []string{st.OwnValue})
+}
+
+// checkDrift compares the values read from Route53 with what this updater
+// last wrote. Each external change is logged, counted and passed to the
+// Drifted hook once, and remembered in the state until the record holds the
+// written value again.
+func (u *Updater) checkDrift(logger zerolog.Logger, rec Record, st *State, values []string) {
+	if !u.drifted(st, values) {
+		st.DriftValues = nil
+		return
+	}
+	if st.DriftValues != nil && slices.Equal(st.DriftValues, values) {
+		return
+	}
+	st.DriftValues = append([]string{}, values...)
+
+	logger.Warn().
+		Str("ownValue", st.OwnValue).
+		Strs("recordValues", values).
+		Str("driftAction", u.driftAction).
+		Msg("record was changed by someone else")
+	u.driftDetected.WithLabelValues(provider.DisplayName(rec.Name)).Inc()
+	if u.hooks.Drifted != nil {
+		u.hooks.Drifted(rec, st, values)
+	}
+}
+
+// unchangedLogLevel returns the level at which an unchanged cycle of the
+// record is logged, see WithUnchangedLogEvery.
+func (u *Updater) unchangedLogLevel(rec Record) zerolog.Level {
+	n := u.unchanged[rec.Key()]
+	u.unchanged[rec.Key()]++
+	if u.unchangedLogEvery > 0 && n%u.unchangedLogEvery == 0 {
+		return zerolog.InfoLevel
+	}
+	return zerolog.DebugLevel
+}
+
+// resetUnchanged restarts the count of unchanged cycles of the record after a
+// change.
+func (u *Updater) resetUnchanged(rec Record) {
+	delete(u.unchanged, rec.Key())
+}
@@ -0,0 +1,103 @@
+package updater
+
+import (
+	"context"
+	"net/netip"
+
+	"flouret.io/update-route53/pkg/ipsource"
+	"flouret.io/update-route53/pkg/provider"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+// prefixMoves returns the delegated prefixes that the given changes move AAAA
+// records from, mapped to the prefix they move them to.
+func prefixMoves(pending []*Change) map[netip.Prefix]netip.Prefix {
+	moves := map[netip.Prefix]netip.Prefix{}
+	for _, c := range pending {
+		if !c.Record.IPv6 {
+			continue
+		}
+		addr, err := netip.ParseAddr(c.Address)
+		if err != nil || !addr.Is6() {
+			continue
+		}
+		to, _ := addr.Prefix(c.Record.PrefixLength)
+		for _, value := range c.Current {
+			addr, err := netip.ParseAddr(value)
+			if err != nil || !addr.Is6() {
+				continue
+			}
+			if from, _ := addr.Prefix(c.Record.PrefixLength); from != to {
+				moves[from] = to
+			}
+		}
+	}
+	return moves
+}
+
+// rewritePrefixes returns the changes that move the other AAAA records of a
+// hosted zone from the old delegated prefixes of the given changes to the new
+// ones, keeping the host part of their values. The records of the cycle are
+// left to their own updates.
+func (u *Updater) rewritePrefixes(ctx context.Context, zone string, pending []*Change, records []Record) ([]types.Change, error) {
+	moves := prefixMoves(pending)
+	if len(moves) == 0 {
+		return nil, nil
+	}
+
+	recordSets, err := provider.New(u.client).RecordSets(ctx, zone, types.RRTypeAaaa)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []types.Change
+	for _, recordSet := range recordSets {
+		if recordSet.AliasTarget != nil || isCycleRecord(recordSet, zone, records) {
+			continue
+		}
+		values := provider.Values(&recordSet)
+		rewritten := false
+		for i, value := range values {
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				continue
+			}
+			for from, to := range moves {
+				if from.Contains(addr) {
+					addr, _ = ipsource.WithSuffix(to.Addr(), to.Bits(), addr)
+					values[i], rewritten = addr.String(), true
+					break
+				}
+			}
+		}
+		if !rewritten {
+			continue
+		}
+
+		u.logger.Info().
+			Str("dnsName", provider.DisplayName(aws.ToString(recordSet.Name))).
+			Str("hostedZoneId", zone).
+			Strs("values", values).
+			Msg("rewriting record to the new prefix")
+		recordSet.ResourceRecords = provider.ResourceRecords(values)
+		changes = append(changes, types.Change{
+			Action:            types.ChangeActionUpsert,
+			ResourceRecordSet: &recordSet,
+		})
+	}
+	return changes, nil
+}
+
+// isCycleRecord reports whether a record set of the given hosted zone is the
+// AAAA record of one of the records of the cycle.
+func isCycleRecord(recordSet types.ResourceRecordSet, zone string, records []Record) bool {
+	for _, rec := range records {
+		if rec.IPv6 && rec.HostedZoneId == zone &&
+			provider.SameName(aws.ToString(recordSet.Name), rec.Name) &&
+			aws.ToString(recordSet.SetIdentifier) == rec.SetIdentifier {
+			return true
+		}
+	}
+	return false
+}
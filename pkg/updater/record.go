@@ -0,0 +1,191 @@
+package updater
+
+import (
+	"fmt"
+	"net/netip"
+	"time"
+
+	"flouret.io/update-route53/pkg/ipsource"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+// Routing policies of a record
+const (
+	RoutingSimple     = "simple"      // A single record set for the name
+	RoutingMultivalue = "multivalue"  // One member of a multivalue answer record set
+	RoutingWeighted   = "weighted"    // One member of a weighted record set
+	RoutingGeo        = "geolocation" // Answer for a geographic location
+	RoutingFailover   = "failover"    // Primary or secondary of a failover pair
+)
+
+// Record describes a DNS record maintained by an Updater.
+type Record struct {
+	Name         string // DNS name, without the trailing dot
+	HostedZoneId string // Route53 hosted zone id
+	TTL          uint64 // TTL for the record
+	CheckIPURL   string // URL to check the public IP address
+	StaticIP     string // Static address to enforce instead of detecting it
+	Interface    string // Network interface to read the address from
+	PrivateZone  bool   // Allow private addresses, for private hosted zones
+
+	// Source of the address, instead of CheckIPURL, StaticIP or Interface
+	AddressSource ipsource.Source
+
+	RoutingPolicy string // Routing policy, see the Routing constants
+	SetIdentifier string // Identifier of this member of a routed record set
+	HealthCheckId string // Route53 health check associated with the record
+	Weight        int64  // Weight of the record, for weighted routing
+
+	// Location of the record, for geolocation routing
+	GeoContinent   string
+	GeoCountry     string
+	GeoSubdivision string
+
+	Failover string // PRIMARY or SECONDARY, for failover routing
+
+	// Maintain a health check that tracks the address, in Hooks.BeforeChange
+	ManageHealthCheck bool
+
+	CNAMETarget string // Maintain a CNAME to this name instead of an A record
+
+	IPv6         bool   // Maintain an AAAA record instead of an A record
+	PrefixLength int    // Bits of the detected address kept, before Suffix
+	Suffix       string // Host part of the address, if not the detected one
+	IID          string // Interface identifier derivation, see ipsource.WithInterfaceID
+
+	Interval time.Duration // Check interval, instead of the global schedule (not used by Run)
+}
+
+// Key returns a string identifying the record across hosted zones.
+func (r Record) Key() string {
+	key := r.HostedZoneId + "/" + r.Name
+	if r.SetIdentifier != "" {
+		key += "/" + r.SetIdentifier
+	}
+	if r.IPv6 {
+		key += "/AAAA"
+	}
+	return key
+}
+
+// RecordType returns the type of the record set maintained for the record.
+func (r Record) RecordType() types.RRType {
+	switch {
+	case r.CNAMETarget != "":
+		return types.RRTypeCname
+	case r.IPv6:
+		return types.RRTypeAaaa
+	}
+	return types.RRTypeA
+}
+
+// ApplyRouting sets the routing policy of the record on a record set. The
+// health check is only set if withHealthCheck is true, so companion records
+// can share the routing policy of the record.
+func (r Record) ApplyRouting(recordSet *types.ResourceRecordSet, withHealthCheck bool) {
+	if r.SetIdentifier == "" {
+		return
+	}
+	recordSet.SetIdentifier = aws.String(r.SetIdentifier)
+
+	switch r.RoutingPolicy {
+	case RoutingMultivalue:
+		recordSet.MultiValueAnswer = aws.Bool(true)
+	case RoutingWeighted:
+		recordSet.Weight = aws.Int64(r.Weight)
+	case RoutingGeo:
+		recordSet.GeoLocation = &types.GeoLocation{}
+		if r.GeoContinent != "" {
+			recordSet.GeoLocation.ContinentCode = aws.String(r.GeoContinent)
+		}
+		if r.GeoCountry != "" {
+			recordSet.GeoLocation.CountryCode = aws.String(r.GeoCountry)
+		}
+		if r.GeoSubdivision != "" {
+			recordSet.GeoLocation.SubdivisionCode = aws.String(r.GeoSubdivision)
+		}
+	case RoutingFailover:
+		recordSet.Failover = types.ResourceRecordSetFailover(r.Failover)
+	}
+
+	if withHealthCheck && r.HealthCheckId != "" {
+		recordSet.HealthCheckId = aws.String(r.HealthCheckId)
+	}
+}
+
+// Source returns where the address of the record is detected from.
+func (r Record) Source() ipsource.Source {
+	switch {
+	case r.AddressSource != nil:
+		return r.AddressSource
+	case r.StaticIP != "":
+		return ipsource.Static(r.StaticIP)
+	case r.Interface != "":
+		return ipsource.Interface(r.Interface)
+	}
+	if source, err := ipsource.Parse(r.CheckIPURL); err == nil {
+		if r.IPv6 {
+			return ipsource.ForIPv6(source)
+		}
+		return source
+	}
+	return ipsource.HTTP(r.CheckIPURL)
+}
+
+// SetSource sets where the address of the record is detected from, given
+// "interface:<name>", "static:<address>", "exec://<program>", "imds://",
+// "imds://ipv6", "ecs://", "ecs://public", "tailscale://[<socket>]",
+// "interface6:<name>" or the URL of a check IP service.
+func (r *Record) SetSource(spec string) error {
+	source, err := ipsource.Parse(spec)
+	if err != nil {
+		return err
+	}
+	r.CheckIPURL, r.Interface, r.StaticIP, r.AddressSource = "", "", "", nil
+	switch source := source.(type) {
+	case ipsource.Static:
+		r.StaticIP = string(source)
+	case ipsource.Interface:
+		r.Interface = string(source)
+	case ipsource.HTTP, ipsource.Exec, ipsource.IMDS, ipsource.ECS, ipsource.Tailscale, ipsource.Interface6, ipsource.Failover:
+		r.CheckIPURL = source.String()
+	}
+	return nil
+}
+
+// HostAddress returns the address that the record should hold given the
+// address detected from its source: with prefix delegation, the detected
+// prefix followed by the suffix of the host, and then its interface
+// identifier if derived. Static addresses are used as is.
+func (r Record) HostAddress(detected string) (string, error) {
+	addr, err := netip.ParseAddr(detected)
+	if err != nil {
+		return "", err
+	}
+	addr = addr.Unmap()
+	if (r.Suffix != "" || r.IID != "") && r.StaticIP == "" {
+		suffix := netip.IPv6Unspecified()
+		if r.Suffix != "" {
+			if suffix, err = netip.ParseAddr(r.Suffix); err != nil {
+				return "", fmt.Errorf("invalid suffix: %w", err)
+			}
+		}
+		addr, err = ipsource.WithSuffix(addr, r.PrefixLength, suffix)
+		if err != nil {
+			return "", err
+		}
+		if r.IID != "" {
+			if addr, err = ipsource.WithInterfaceID(addr, r.IID); err != nil {
+				return "", err
+			}
+		}
+	}
+	switch {
+	case r.IPv6 && !addr.Is6():
+		return "", fmt.Errorf("detected address %s is not an ipv6 address", detected)
+	case !r.IPv6 && !addr.Is4():
+		return "", fmt.Errorf("detected address %s is not an ipv4 address", detected)
+	}
+	return addr.String(), nil
+}
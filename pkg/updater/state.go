@@ -0,0 +1,26 @@
+package updater
+
+import "time"
+
+// State is what is known about a managed record. It is kept by the Updater
+// between update cycles, and can be persisted, see WithState.
+type State struct {
+	LastAddress string    `json:"lastAddress,omitempty"` // Last detected address
+	RecordTTL   uint64    `json:"recordTTL,omitempty"`   // Last known TTL of the record
+	LastChange  time.Time `json:"lastChange,omitempty"`  // Time of the last change
+	OwnValue    string    `json:"ownValue,omitempty"`    // Last value written by this instance
+
+	// Last known values of the record
+	RecordValues []string `json:"recordValues,omitempty"`
+
+	// Time the record value was last read from Route53
+	LastVerified time.Time `json:"lastVerified,omitempty"`
+
+	// Values of the record when it was last found changed by someone else,
+	// nil if it holds the value written by this instance
+	DriftValues []string `json:"driftValues,omitempty"`
+
+	// Health check managed for the record, and the address it checks
+	HealthCheckId      string `json:"healthCheckId,omitempty"`
+	HealthCheckAddress string `json:"healthCheckAddress,omitempty"`
+}
@@ -0,0 +1,459 @@
+// Package updater keeps DNS records in Route53 hosted zones set to the
+// addresses detected from their sources.
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"flouret.io/update-route53/pkg/ipsource"
+	"flouret.io/update-route53/pkg/provider"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+)
+
+// Actions on records changed by someone else, see WithDriftAction
+const (
+	DriftReassert = "reassert" // Write the desired values back
+	DriftAlert    = "alert"    // Leave the record as it was changed
+)
+
+var (
+	// ErrCheckIP wraps the errors detecting the address of a record.
+	ErrCheckIP = errors.New("unable to detect address")
+
+	// ErrPropagationTimeout is returned when a change is not INSYNC before
+	// the propagation timeout, see WithPropagationTimeout.
+	ErrPropagationTimeout = errors.New("change not in sync before the propagation timeout")
+
+	// ErrAliasRecord is returned when the record is an alias, unless aliases
+	// are replaced, see WithReplaceAlias.
+	ErrAliasRecord = errors.New("record is an alias")
+
+	// ErrRecordMissing is returned when the record does not exist and only
+	// existing records are updated, see WithRequireExisting.
+	ErrRecordMissing = errors.New("record does not exist")
+)
+
+// Hooks extend the update cycle of an Updater, for example with ownership
+// checks, locking and notifications. All hooks are optional.
+type Hooks struct {
+	// Detect returns the address detected from a source, for example with
+	// retries. By default, the source is attempted once.
+	Detect func(ctx context.Context, source ipsource.Source) (string, error)
+
+	// SkipRead reports whether the records are not read from Route53, in
+	// which case their cached values are used, for example when a budget of
+	// API calls is spent.
+	SkipRead func() bool
+
+	// Drifted is called when a record is found changed by someone else.
+	Drifted func(rec Record, st *State, values []string)
+
+	// Check runs before an existing (exists) or new record is changed, and
+	// refuses the change by returning an error, for example when the record
+	// is owned by someone else. Failures are logged by the hook.
+	Check func(ctx context.Context, rec Record, logger zerolog.Logger, exists bool) error
+
+	// Lock locks a record before it is changed, and returns the function
+	// releasing the lock. The record is read again once locked.
+	Lock func(ctx context.Context, rec Record) (func(), error)
+
+	// BeforeChange runs once a change is decided, and refuses it by
+	// returning an error, for example when a pre-update script fails. It may
+	// set the health check of the record. Failures are logged by the hook.
+	BeforeChange func(ctx context.Context, c *Change) error
+
+	// Companions returns the changes of other record sets that are submitted
+	// along with the change of a record, for example an ownership record.
+	Companions func(c *Change) []types.Change
+
+	// Submitted is called once the changes of a batch of records are
+	// submitted to a hosted zone, for example to audit them.
+	Submitted func(zone, changeId string, changes []types.Change, batch []*Change)
+
+	// Changed is called once the change of a record is INSYNC, or submitted
+	// for CNAME records.
+	Changed func(ctx context.Context, c *Change)
+
+	// Comment returns the comment of change batches.
+	Comment func() string
+}
+
+// Updater keeps DNS records set to the addresses detected from their
+// sources.
+type Updater struct {
+	client   *route53.Client
+	records  []Record
+	interval time.Duration
+	logger   zerolog.Logger
+	hooks    Hooks
+	state    map[string]*State
+
+	// Record added by WithRecord, WithTTL and WithIPSource
+	name, zone string
+	ttl        uint64
+	source     ipsource.Source
+
+	allowBogon           bool
+	verifyInterval       time.Duration
+	dnsLookups           bool
+	replaceAlias         bool
+	requireExisting      bool
+	merge                bool
+	driftAction          string
+	confirmations        uint64
+	confirmationInterval time.Duration
+	minChangeInterval    time.Duration
+	propagationTimeout   time.Duration
+	prefixRewrite        bool
+	unchangedLogEvery    uint64
+
+	rejectedAddresses   *prometheus.CounterVec
+	propagationDuration prometheus.Histogram
+	driftDetected       *prometheus.CounterVec
+
+	failed       map[string]bool      // Records whose last update failed
+	unchanged    map[string]uint64    // Consecutive unchanged cycles of each record
+	privateZones map[string]bool      // Whether each hosted zone is private, with DNS lookups
+	detections   map[string]detection // Detections of the running cycle, by source
+}
+
+// Option configures an Updater.
+type Option func(*Updater) error
+
+// WithRecord adds an A record with the given host name, in the Route53 hosted
+// zone with the given id. Its TTL and source are set by WithTTL and
+// WithIPSource.
+func WithRecord(name, hostedZoneId string) Option {
+	return func(u *Updater) error {
+		name, err := provider.NormalizeName(name)
+		if err != nil {
+			return fmt.Errorf("invalid record name: %w", err)
+		}
+		if hostedZoneId == "" {
+			return errors.New("missing hosted zone id")
+		}
+		u.name, u.zone = name, hostedZoneId
+		return nil
+	}
+}
+
+// WithTTL sets the TTL of the record of WithRecord. The default is 300
+// seconds.
+func WithTTL(ttl uint64) Option {
+	return func(u *Updater) error {
+		if ttl > 2147483647 {
+			return fmt.Errorf("TTL %d is too large", ttl)
+		}
+		u.ttl = ttl
+		return nil
+	}
+}
+
+// WithIPSource sets where the address of the record of WithRecord is detected
+// from. The default is http://checkip.amazonaws.com/.
+func WithIPSource(source ipsource.Source) Option {
+	return func(u *Updater) error {
+		if source == nil {
+			return errors.New("missing ip source")
+		}
+		u.source = source
+		return nil
+	}
+}
+
+// WithRecords adds records described in full.
+func WithRecords(records ...Record) Option {
+	return func(u *Updater) error {
+		for _, rec := range records {
+			if rec.Name == "" || rec.HostedZoneId == "" {
+				return errors.New("records require a name and a hosted zone id")
+			}
+		}
+		u.records = append(u.records, records...)
+		return nil
+	}
+}
+
+// WithInterval sets the time between cycles of Run. The default is 5
+// minutes.
+func WithInterval(interval time.Duration) Option {
+	return func(u *Updater) error {
+		if interval <= 0 {
+			return errors.New("interval must be positive")
+		}
+		u.interval = interval
+		return nil
+	}
+}
+
+// WithAllowBogon allows publishing addresses in private and reserved ranges,
+// which are refused by default, except private and CGNAT addresses in private
+// hosted zones.
+func WithAllowBogon(allow bool) Option {
+	return func(u *Updater) error {
+		u.allowBogon = allow
+		return nil
+	}
+}
+
+// WithLogger sets the logger. Nothing is logged by default.
+func WithLogger(logger zerolog.Logger) Option {
+	return func(u *Updater) error {
+		u.logger = logger
+		return nil
+	}
+}
+
+// WithMetrics registers the metrics of the update cycles with the given
+// registerer.
+func WithMetrics(registerer prometheus.Registerer) Option {
+	return func(u *Updater) error {
+		for _, c := range []prometheus.Collector{u.rejectedAddresses, u.propagationDuration, u.driftDetected} {
+			if err := registerer.Register(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// WithHooks sets the hooks extending the update cycle.
+func WithHooks(hooks Hooks) Option {
+	return func(u *Updater) error {
+		u.hooks = hooks
+		return nil
+	}
+}
+
+// WithState sets the state of the records, keyed by Record.Key, for example
+// as saved by a previous run. The update cycles keep it up to date.
+func WithState(state map[string]*State) Option {
+	return func(u *Updater) error {
+		if state == nil {
+			return errors.New("missing state")
+		}
+		u.state = state
+		return nil
+	}
+}
+
+// WithVerifyInterval reads the records from Route53 at most once per
+// interval, using their cached values in between. By default, the records
+// are read on every cycle.
+func WithVerifyInterval(interval time.Duration) Option {
+	return func(u *Updater) error {
+		u.verifyInterval = interval
+		return nil
+	}
+}
+
+// WithDNSLookups reads the records from the authoritative nameservers of
+// their zone instead of the Route53 API, except in private hosted zones.
+func WithDNSLookups(enabled bool) Option {
+	return func(u *Updater) error {
+		u.dnsLookups = enabled
+		return nil
+	}
+}
+
+// WithReplaceAlias replaces alias records with plain records, instead of
+// failing with ErrAliasRecord.
+func WithReplaceAlias(replace bool) Option {
+	return func(u *Updater) error {
+		u.replaceAlias = replace
+		return nil
+	}
+}
+
+// WithRequireExisting only updates records that already exist, failing with
+// ErrRecordMissing otherwise.
+func WithRequireExisting(require bool) Option {
+	return func(u *Updater) error {
+		u.requireExisting = require
+		return nil
+	}
+}
+
+// WithMergeValues only replaces the value written by the Updater in record
+// sets, keeping the values written by others, instead of replacing all
+// values with the address.
+func WithMergeValues(merge bool) Option {
+	return func(u *Updater) error {
+		u.merge = merge
+		return nil
+	}
+}
+
+// WithDriftAction sets what to do with records changed by someone else:
+// DriftReassert (the default) or DriftAlert.
+func WithDriftAction(action string) Option {
+	return func(u *Updater) error {
+		if action != DriftReassert && action != DriftAlert {
+			return fmt.Errorf("invalid drift action %q", action)
+		}
+		u.driftAction = action
+		return nil
+	}
+}
+
+// WithConfirmations requires a new address to be detected the given number
+// of times in a row, the given interval apart, before it is published. The
+// default is 1.
+func WithConfirmations(confirmations uint64, interval time.Duration) Option {
+	return func(u *Updater) error {
+		if confirmations < 1 {
+			return errors.New("confirmations must be at least 1")
+		}
+		u.confirmations, u.confirmationInterval = confirmations, interval
+		return nil
+	}
+}
+
+// WithMinChangeInterval skips the changes of a record until the given
+// interval has elapsed since its last change.
+func WithMinChangeInterval(interval time.Duration) Option {
+	return func(u *Updater) error {
+		u.minChangeInterval = interval
+		return nil
+	}
+}
+
+// WithPropagationTimeout sets how long to wait for changes to be INSYNC. The
+// default is 10 minutes.
+func WithPropagationTimeout(timeout time.Duration) Option {
+	return func(u *Updater) error {
+		if timeout <= 0 {
+			return errors.New("propagation timeout must be positive")
+		}
+		u.propagationTimeout = timeout
+		return nil
+	}
+}
+
+// WithPrefixRewrite moves the other AAAA records of the hosted zones from the
+// old delegated prefix of an IPv6 record to the new one, keeping their host
+// part.
+func WithPrefixRewrite(rewrite bool) Option {
+	return func(u *Updater) error {
+		u.prefixRewrite = rewrite
+		return nil
+	}
+}
+
+// WithUnchangedLogEvery logs unchanged records at info level on the first
+// unchanged cycle after a change and every n cycles after that, and at debug
+// level otherwise. With 0, they are always logged at debug level. The default
+// is 1.
+func WithUnchangedLogEvery(n uint64) Option {
+	return func(u *Updater) error {
+		u.unchangedLogEvery = n
+		return nil
+	}
+}
+
+// New returns an Updater using the given Route53 client.
+func New(client *route53.Client, opts ...Option) (*Updater, error) {
+	u := &Updater{
+		client:   client,
+		interval: 5 * time.Minute,
+		logger:   zerolog.Nop(),
+		state:    map[string]*State{},
+		ttl:      300,
+		source:   ipsource.HTTP("http://checkip.amazonaws.com/"),
+
+		driftAction:          DriftReassert,
+		confirmations:        1,
+		confirmationInterval: 10 * time.Second,
+		propagationTimeout:   10 * time.Minute,
+		unchangedLogEvery:    1,
+
+		rejectedAddresses: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "update_route53_rejected_addresses_total",
+			Help: "Number of detected addresses rejected as bogons",
+		}, []string{"reason"}),
+		propagationDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "update_route53_propagation_seconds",
+			Help:    "Time from the acceptance of changes by Route53 until they are INSYNC",
+			Buckets: []float64{10, 20, 30, 45, 60, 90, 120, 180, 300, 600},
+		}),
+		driftDetected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "update_route53_drift_total",
+			Help: "Changes of the records by someone else, by record",
+		}, []string{"record"}),
+
+		failed:       map[string]bool{},
+		unchanged:    map[string]uint64{},
+		privateZones: map[string]bool{},
+	}
+	for _, opt := range opts {
+		if err := opt(u); err != nil {
+			return nil, err
+		}
+	}
+	if u.name != "" {
+		u.records = append(u.records, Record{
+			Name:          u.name,
+			HostedZoneId:  u.zone,
+			TTL:           u.ttl,
+			AddressSource: u.source,
+		})
+	}
+	return u, nil
+}
+
+// State returns the state of the given record, creating it if needed.
+func (u *Updater) State(rec Record) *State {
+	st := u.state[rec.Key()]
+	if st == nil {
+		st = &State{}
+		u.state[rec.Key()] = st
+	}
+	return st
+}
+
+// RunOnce runs a single update cycle for each record: it detects the address
+// and changes the record if needed, waiting until the change is INSYNC. It
+// reports whether a record was changed, and returns the errors of the records
+// that failed.
+func (u *Updater) RunOnce(ctx context.Context) (bool, error) {
+	if len(u.records) == 0 {
+		return false, errors.New("no records to update, see WithRecord")
+	}
+	errs, changed := u.update(ctx, u.records)
+	var joined []error
+	for i, err := range errs {
+		if err != nil {
+			joined = append(joined, fmt.Errorf("%s: %w", u.records[i].Name, err))
+		}
+	}
+	return changed, errors.Join(joined...)
+}
+
+// Run runs update cycles every interval until the context is done. Failed
+// cycles are logged and retried at the next interval.
+func (u *Updater) Run(ctx context.Context) error {
+	for {
+		u.RunOnce(ctx)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(u.interval):
+		}
+	}
+}
+
+// Update runs a single update cycle for each of the given records, which
+// need not be the records of the Updater. The changes of records in the same
+// hosted zone are submitted together, and their propagation is awaited once.
+// It returns the error of each record.
+func (u *Updater) Update(ctx context.Context, records []Record) []error {
+	errs, _ := u.update(ctx, records)
+	return errs
+}
@@ -0,0 +1,35 @@
+package updater
+
+import (
+	"slices"
+)
+
+// DesiredValues returns the values the record set should have given its
+// current values, the value previously written by this updater (if any) and
+// the current address. With merge, the values written by others are kept;
+// otherwise the address replaces all values. The result is sorted.
+func DesiredValues(current []string, own, address string, merge bool) []string {
+	if !merge {
+		return []string{address}
+	}
+
+	values := []string{address}
+	for _, value := range current {
+		if value != own && value != address {
+			values = append(values, value)
+		}
+	}
+	slices.Sort(values)
+	return values
+}
+
+// DroppedValues returns the values of current that are not in desired.
+func DroppedValues(current, desired []string) []string {
+	var dropped []string
+	for _, value := range current {
+		if !slices.Contains(desired, value) {
+			dropped = append(dropped, value)
+		}
+	}
+	return dropped
+}
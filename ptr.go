@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"flouret.io/update-route53/pkg/provider"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+// reverseName returns the name of the PTR record of an address: in
+// in-addr.arpa for IPv4, and one label per nibble in ip6.arpa for IPv6.
+func reverseName(addr netip.Addr) string {
+	if addr.Is4() {
+		b := addr.As4()
+		return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa", b[3], b[2], b[1], b[0])
+	}
+	var name strings.Builder
+	b := addr.As16()
+	for i := len(b) - 1; i >= 0; i-- {
+		fmt.Fprintf(&name, "%x.%x.", b[i]&0xf, b[i]>>4)
+	}
+	name.WriteString("ip6.arpa")
+	return name.String()
+}
+
+// updatePTR points the PTR record of the new address at the record, and
+// deletes the PTR records of the addresses removed from the record that
+// still point at it.
+func updatePTR(svc *route53.Client, rec record, removedAddresses []string, newAddress string) error {
+	target := strings.TrimSuffix(rec.Name, ".") + "."
+
+	addr, err := netip.ParseAddr(newAddress)
+	if err != nil {
+		return err
+	}
+	changes := []types.Change{{
+		Action: types.ChangeActionUpsert,
+		ResourceRecordSet: &types.ResourceRecordSet{
+			Name:            aws.String(reverseName(addr)),
+			Type:            types.RRTypePtr,
+			TTL:             aws.Int64(int64(rec.TTL)),
+			ResourceRecords: provider.ResourceRecords([]string{target}),
+		},
+	}}
+
+	for _, old := range removedAddresses {
+		addr, err := netip.ParseAddr(old)
+		if err != nil || old == newAddress {
+			continue
+		}
+		// Deleting requires the exact current record set
+		recordSet, err := provider.New(svc).RecordSet(context.TODO(), reverseHostedZoneId, reverseName(addr), types.RRTypePtr, "")
+		if err != nil {
+			return err
+		}
+		if recordSet != nil && len(recordSet.ResourceRecords) == 1 &&
+			strings.EqualFold(aws.ToString(recordSet.ResourceRecords[0].Value), target) {
+			changes = append(changes, types.Change{
+				Action:            types.ChangeActionDelete,
+				ResourceRecordSet: recordSet,
+			})
+		}
+	}
+
+	changeId, err := newProvider(svc).Change(context.TODO(), reverseHostedZoneId, changes)
+	if err != nil {
+		return err
+	}
+	auditChanges(reverseHostedZoneId, changeId, changes, nil)
+	return nil
+}
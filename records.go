@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"flouret.io/update-route53/pkg/provider"
+)
+
+// parseRecords parses the additional records of RECORDS. Records are
+// separated by semicolons or newlines, and each is a comma-separated list of
+// key=value pairs:
+//
+//	name=vpn.example.com,zone=Z123,ttl=60,source=interface:wg0,interval=1m
+//
+// Only the name is required; the other keys default to the fields of
+// defaults. With a suffix, the record is an AAAA record holding the detected
+// prefix followed by the suffix:
+//
+//	name=nas.example.com,source=interface6:eth0,prefix=56,suffix=::a:1a2b:3c4d:5e6f:7081
+func parseRecords(s string, defaults record) ([]record, error) {
+	var records []record
+	entries := strings.FieldsFunc(s, func(r rune) bool { return r == ';' || r == '\n' })
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		rec := defaults
+		typeA := false // Whether the type is explicitly A
+		for _, field := range strings.Split(entry, ",") {
+			key, value, ok := strings.Cut(strings.TrimSpace(field), "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid field %q in record %q", field, entry)
+			}
+			var err error
+			switch key {
+			case "name":
+				rec.Name, err = provider.NormalizeName(value)
+			case "zone":
+				rec.HostedZoneId = value
+			case "ttl":
+				rec.TTL, err = parseTTL(value)
+			case "source":
+				err = rec.SetSource(value)
+			case "private":
+				rec.PrivateZone, err = strconv.ParseBool(value)
+			case "type":
+				if value != "A" && value != "AAAA" {
+					err = fmt.Errorf("type must be A or AAAA")
+				}
+				rec.IPv6, typeA = value == "AAAA", value == "A"
+			case "prefix":
+				rec.PrefixLength, err = parsePrefixLength(value)
+			case "suffix":
+				rec.Suffix, err = parseSuffix(value)
+			case "iid":
+				rec.IID, err = parseIID(value)
+			case "interval":
+				rec.Interval, err = time.ParseDuration(value)
+				if err == nil && rec.Interval <= 0 {
+					err = fmt.Errorf("interval must be positive")
+				}
+			default:
+				err = fmt.Errorf("unknown key %q", key)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid record %q: %w", entry, err)
+			}
+		}
+		if rec.Name == "" {
+			return nil, fmt.Errorf("missing name in record %q", entry)
+		}
+		if rec.HostedZoneId == "" {
+			return nil, fmt.Errorf("missing zone in record %q", entry)
+		}
+		if rec.Suffix != "" || rec.IID != "" {
+			if typeA {
+				return nil, fmt.Errorf("suffix and iid require type AAAA in record %q", entry)
+			}
+			rec.IPv6 = true
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
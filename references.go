@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// Prefixes of option values that reference values stored in AWS
+const (
+	ssmPrefix            = "ssm://"            // ssm:///path/to/parameter
+	secretsManagerPrefix = "secretsmanager://" // secretsmanager://secret-id[#json-key]
+)
+
+// referenceTimeout bounds the resolution of all the references at startup.
+const referenceTimeout = 30 * time.Second
+
+// referenceResolver resolves references to SSM parameters and Secrets
+// Manager secrets. AWS clients are created on first use.
+type referenceResolver struct {
+	cfg            *aws.Config
+	ssm            *ssm.Client
+	secretsManager *secretsmanager.Client
+}
+
+// awsConfig returns the AWS configuration, loading it on first use.
+func (r *referenceResolver) awsConfig(ctx context.Context) (aws.Config, error) {
+	if r.cfg == nil {
+		cfg, err := config.LoadDefaultConfig(ctx, config.WithAPIOptions([]func(*middleware.Stack) error{instrumentAPICalls}))
+		if err != nil {
+			return aws.Config{}, err
+		}
+		r.cfg = &cfg
+	}
+	return *r.cfg, nil
+}
+
+// resolveSSM returns the value of an SSM parameter, decrypted if it is a
+// SecureString.
+func (r *referenceResolver) resolveSSM(ctx context.Context, name string) (string, error) {
+	if r.ssm == nil {
+		cfg, err := r.awsConfig(ctx)
+		if err != nil {
+			return "", err
+		}
+		r.ssm = ssm.NewFromConfig(cfg)
+	}
+	out, err := r.ssm.GetParameter(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(out.Parameter.Value), nil
+}
+
+// resolveSecret returns the value of a Secrets Manager secret, or of a key
+// of a secret holding a JSON object.
+func (r *referenceResolver) resolveSecret(ctx context.Context, ref string) (string, error) {
+	if r.secretsManager == nil {
+		cfg, err := r.awsConfig(ctx)
+		if err != nil {
+			return "", err
+		}
+		r.secretsManager = secretsmanager.NewFromConfig(cfg)
+	}
+	secretId, key, hasKey := strings.Cut(ref, "#")
+	out, err := r.secretsManager.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secretId),
+	})
+	if err != nil {
+		return "", err
+	}
+	value := aws.ToString(out.SecretString)
+	if !hasKey {
+		return value, nil
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(value), &fields); err != nil {
+		return "", fmt.Errorf("secret is not a JSON object: %w", err)
+	}
+	field, ok := fields[key]
+	if !ok {
+		return "", fmt.Errorf("secret has no key %q", key)
+	}
+	if s, ok := field.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprint(field), nil
+}
+
+// resolveConfigReferences replaces the environment variable of each option
+// set to an ssm:// or secretsmanager:// reference with the referenced value.
+func resolveConfigReferences(ctx context.Context) error {
+	var r referenceResolver
+	for _, opt := range configOptions {
+		ref := os.Getenv(opt.Name)
+
+		var value string
+		var err error
+		switch {
+		case strings.HasPrefix(ref, ssmPrefix):
+			value, err = r.resolveSSM(ctx, strings.TrimPrefix(ref, ssmPrefix))
+		case strings.HasPrefix(ref, secretsManagerPrefix):
+			value, err = r.resolveSecret(ctx, strings.TrimPrefix(ref, secretsManagerPrefix))
+		default:
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("unable to resolve %s: %w", opt.Name, err)
+		}
+		if err := os.Setenv(opt.Name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
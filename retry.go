@@ -0,0 +1,61 @@
+package main
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// retryInitialDelay is the delay before the first retry of a failed attempt,
+// doubled for each following retry up to retryMaxDelay.
+const retryInitialDelay = time.Second
+
+// retryDelay returns the delay before the given retry (1 for the first), with
+// exponential backoff and jitter.
+func retryDelay(retry int) time.Duration {
+	delay := retryInitialDelay << (retry - 1)
+	if delay > retryMaxDelay || delay <= 0 {
+		delay = retryMaxDelay
+	}
+	return equalJitter(delay)
+}
+
+// withRetries calls fn up to retryAttempts times, with a backoff between
+// attempts, until it succeeds. It returns the last error.
+func withRetries(what string, fn func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil || attempt >= retryAttempts {
+			return err
+		}
+		delay := retryDelay(attempt)
+		logger.Warn().
+			Err(err).
+			Int("attempt", attempt).
+			Str("delay", delay.String()).
+			Msgf("unable to %s, retrying", what)
+		time.Sleep(delay)
+	}
+}
+
+// awsRetryer returns the retryer of AWS API calls, which retries transient
+// errors such as throttling and server errors with the same limits as
+// withRetries, backing off longer after throttling.
+func awsRetryer() aws.Retryer {
+	return retry.NewStandard(func(o *retry.StandardOptions) {
+		o.MaxAttempts = retryAttempts
+		o.MaxBackoff = retryMaxDelay
+		o.Backoff = awsBackoff()
+	})
+}
+
+// awsConfigOptions returns the options used to load the AWS configuration.
+func awsConfigOptions() []func(*config.LoadOptions) error {
+	return []func(*config.LoadOptions) error{
+		config.WithRetryer(awsRetryer),
+		config.WithAPIOptions([]func(*middleware.Stack) error{instrumentAPICalls}),
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+// healthCheckCallerReference returns the caller reference of the health
+// check managed for the given record. It is derived from the record so the
+// health check can be found again after a restart.
+func healthCheckCallerReference(rec record) string {
+	sum := sha256.Sum256([]byte(rec.Key()))
+	return "update-route53-" + hex.EncodeToString(sum[:16])
+}
+
+// findHealthCheck returns the id of the health check with the given caller
+// reference, or an empty string if there is none.
+func findHealthCheck(svc *route53.Client, callerReference string) (string, error) {
+	paginator := route53.NewListHealthChecksPaginator(svc, &route53.ListHealthChecksInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return "", err
+		}
+		for _, healthCheck := range page.HealthChecks {
+			if aws.ToString(healthCheck.CallerReference) == callerReference {
+				return aws.ToString(healthCheck.Id), nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// syncHealthCheck creates the health check managed for the given record if
+// needed, and points it at address. The id of the health check is kept in
+// the state of the record.
+func syncHealthCheck(svc *route53.Client, rec record, st *recordState, address string) error {
+	if st.HealthCheckId == "" {
+		id, err := findHealthCheck(svc, healthCheckCallerReference(rec))
+		if err != nil {
+			return err
+		}
+		st.HealthCheckId = id
+	}
+
+	if st.HealthCheckId == "" {
+		config := &types.HealthCheckConfig{
+			Type:      types.HealthCheckType(healthCheckType),
+			IPAddress: aws.String(address),
+			Port:      aws.Int32(int32(healthCheckPort)),
+		}
+		if config.Type != types.HealthCheckTypeTcp {
+			config.ResourcePath = aws.String(healthCheckPath)
+			config.FullyQualifiedDomainName = aws.String(rec.Name)
+		}
+		output, err := svc.CreateHealthCheck(context.TODO(), &route53.CreateHealthCheckInput{
+			CallerReference:   aws.String(healthCheckCallerReference(rec)),
+			HealthCheckConfig: config,
+		})
+		if err != nil {
+			return err
+		}
+		st.HealthCheckId = aws.ToString(output.HealthCheck.Id)
+		st.HealthCheckAddress = address
+		return nil
+	}
+
+	if st.HealthCheckAddress != address {
+		_, err := svc.UpdateHealthCheck(context.TODO(), &route53.UpdateHealthCheckInput{
+			HealthCheckId: aws.String(st.HealthCheckId),
+			IPAddress:     aws.String(address),
+		})
+		if err != nil {
+			return err
+		}
+		st.HealthCheckAddress = address
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"math/rand/v2"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// cronParser parses SCHEDULE: standard cron expressions with an optional
+// leading seconds field, or descriptors such as @hourly
+var cronParser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour |
+	cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// nextSleepPeriod returns how long to wait before the next update cycle,
+// with jitter applied.
+func nextSleepPeriod() time.Duration {
+	return applyJitter(baseSleepPeriod(), sleepJitter)
+}
+
+// applyJitter randomly adjusts d by up to ±fraction of its value, so
+// instances started at the same time do not run in lockstep.
+func applyJitter(d time.Duration, fraction float64) time.Duration {
+	if fraction <= 0 {
+		return d
+	}
+	return time.Duration(float64(d) * (1 + fraction*(2*rand.Float64()-1)))
+}
+
+// baseSleepPeriod returns how long to wait before the next update cycle,
+// without jitter.
+func baseSleepPeriod() time.Duration {
+	// Align cycles to wall-clock times
+	period := sleepPeriod
+	if schedule != nil {
+		now := time.Now()
+		period = schedule.Next(now).Sub(now)
+	}
+
+	// Poll faster for a while after a change, as address changes often
+	// come in bursts, decaying linearly back to the normal period across
+	// the window
+	if fastSleepPeriod > 0 {
+		var lastChange time.Time
+		for _, st := range state {
+			if st.LastChange.After(lastChange) {
+				lastChange = st.LastChange
+			}
+		}
+		if elapsed := time.Since(lastChange); elapsed < fastPeriodWindow {
+			progress := float64(elapsed) / float64(fastPeriodWindow)
+			return fastSleepPeriod + time.Duration(progress*float64(period-fastSleepPeriod))
+		}
+	}
+	return period
+}
+
+// nextCheck is when each record is due to be checked next, keyed by
+// record.Key(). Records that are not in it are due.
+var nextCheck = map[string]time.Time{}
+
+// dueRecords returns the records that are due to be checked at now.
+func dueRecords(records []record, now time.Time) []record {
+	var due []record
+	for _, rec := range records {
+		if !now.Before(nextCheck[rec.Key()]) {
+			due = append(due, rec)
+		}
+	}
+	return due
+}
+
+// scheduleRecords sets when the given records, checked at now, are due
+// again: after their own interval if they have one, or after period.
+func scheduleRecords(records []record, now time.Time, period time.Duration) {
+	for _, rec := range records {
+		if rec.Interval > 0 {
+			nextCheck[rec.Key()] = now.Add(applyJitter(rec.Interval, sleepJitter))
+		} else {
+			nextCheck[rec.Key()] = now.Add(period)
+		}
+	}
+}
+
+// untilNextCheck returns how long to wait until the first of the given
+// records is due.
+func untilNextCheck(records []record) time.Duration {
+	var next time.Time
+	for _, rec := range records {
+		if t := nextCheck[rec.Key()]; next.IsZero() || t.Before(next) {
+			next = t
+		}
+	}
+	return max(time.Until(next), 0)
+}
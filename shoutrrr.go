@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/containrrr/shoutrrr"
+	"github.com/containrrr/shoutrrr/pkg/router"
+	"github.com/containrrr/shoutrrr/pkg/types"
+)
+
+// shoutrrrNotifier fans events out to every service URL supported by
+// shoutrrr (slack://, discord://, smtp://, gotify://, ...).
+type shoutrrrNotifier struct {
+	sender *router.ServiceRouter
+}
+
+// newShoutrrrNotifier creates a notifier for a comma or space separated list
+// of shoutrrr service URLs.
+func newShoutrrrNotifier(urls string) (*shoutrrrNotifier, error) {
+	sender, err := shoutrrr.CreateSender(strings.FieldsFunc(urls, func(r rune) bool {
+		return r == ',' || r == ' '
+	})...)
+	if err != nil {
+		return nil, err
+	}
+	return &shoutrrrNotifier{sender: sender}, nil
+}
+
+func (n *shoutrrrNotifier) name() string {
+	return "shoutrrr"
+}
+
+func (n *shoutrrrNotifier) notify(ev event) error {
+	title, message := eventTitle(ev), eventMessage(ev)
+	if title == "" {
+		return nil
+	}
+
+	params := types.Params{"title": title}
+	return errors.Join(n.sender.Send(message, &params)...)
+}
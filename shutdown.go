@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	"flouret.io/update-route53/pkg/provider"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+// Actions performed on the record on graceful shutdown (ON_SHUTDOWN)
+const (
+	shutdownActionNone   = ""
+	shutdownActionDelete = "delete"
+	shutdownActionRevert = "revert"
+)
+
+// cycleMu is held while an update cycle runs so shutdown does not race with
+// an in-flight change.
+var cycleMu sync.Mutex
+
+// handleShutdown waits for SIGINT or SIGTERM, then deletes the records or
+// reverts them to originals (the record sets at startup, nil if they did not
+// exist) before exiting.
+func handleShutdown(svc *route53.Client, records []record, action string, originals []*types.ResourceRecordSet) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-signals
+
+	logger := logger.With().
+		Str("signal", sig.String()).
+		Str("action", action).
+		Logger()
+	logger.Info().Msg("shutting down")
+
+	// Wait for the current cycle, and prevent new ones from starting
+	cycleMu.Lock()
+
+	exitCode := 0
+	for i, rec := range records {
+		logger := logger.With().
+			Str("dnsName", provider.DisplayName(rec.Name)).
+			Str("hostedZoneId", rec.HostedZoneId).
+			Logger()
+		if err := cleanupRecord(svc, rec, action, originals[i]); err != nil {
+			logger.Err(err).Msg("unable to clean up record")
+			exitCode = 1
+			continue
+		}
+		logger.Info().Msg("record cleaned up")
+	}
+	if stateFile != "" {
+		if err := saveState(stateFile); err != nil {
+			logger.Err(err).Str("stateFile", stateFile).Msg("unable to save state")
+		}
+	}
+
+	flushLogs()
+	os.Exit(exitCode)
+}
+
+// exitAfter exits cleanly once the process has run for the given duration
+// (RUN_FOR), after the current cycle. Records are left as they are.
+func exitAfter(d time.Duration) {
+	time.Sleep(d)
+	cycleMu.Lock()
+	logger.Info().Str("runFor", d.String()).Msg("maximum runtime reached, exiting")
+	flushLogs()
+	os.Exit(0)
+}
+
+// flushLogs ships the last logs to CloudWatch Logs and Loki before exiting.
+func flushLogs() {
+	if cloudWatchLogs != nil {
+		cloudWatchLogs.flush()
+	}
+	if lokiLogs != nil {
+		lokiLogs.flush()
+	}
+}
+
+func cleanupRecord(svc *route53.Client, rec record, action string, original *types.ResourceRecordSet) error {
+	if protectedRecords[rec.Key()] {
+		return errProtected
+	}
+
+	current, err := getRecordSet(svc, rec)
+	if err != nil {
+		return fmt.Errorf("unable to get current record: %w", err)
+	}
+
+	// In merge mode, only remove the value written by this instance
+	var remaining []string
+	reverting := action == shutdownActionRevert && original != nil
+	if current != nil && multiValueMode == multiValueMerge && !reverting {
+		remaining = slices.DeleteFunc(provider.Values(current), func(value string) bool {
+			return value == stateFor(rec).OwnValue
+		})
+		if len(remaining) == len(current.ResourceRecords) {
+			return nil
+		}
+	}
+
+	var changes []types.Change
+	switch {
+	case reverting:
+		changes = append(changes, types.Change{
+			Action:            types.ChangeActionUpsert,
+			ResourceRecordSet: original,
+		})
+	case len(remaining) > 0:
+		recordSet := *current
+		recordSet.ResourceRecords = provider.ResourceRecords(remaining)
+		changes = append(changes, types.Change{
+			Action:            types.ChangeActionUpsert,
+			ResourceRecordSet: &recordSet,
+		})
+	case current != nil:
+		// Deleting requires the exact current record sets, and the record
+		// may have been taken over by another instance since the last cycle
+		var ownerRecordSet *types.ResourceRecordSet
+		if ownerID != "" {
+			ownerRecordSet, err = getOwnerRecordSet(svc, rec)
+			if err != nil {
+				return fmt.Errorf("unable to get record owner: %w", err)
+			}
+			if owner := ownerOf(ownerRecordSet); owner != ownerRecordValue() && !forceOwnership {
+				return fmt.Errorf("%w: %s", errNotOwner, owner)
+			}
+		}
+		changes = append(changes, types.Change{
+			Action:            types.ChangeActionDelete,
+			ResourceRecordSet: current,
+		})
+		if ownerRecordSet != nil {
+			changes = append(changes, types.Change{
+				Action:            types.ChangeActionDelete,
+				ResourceRecordSet: ownerRecordSet,
+			})
+		}
+	default:
+		return nil
+	}
+
+	output, err := svc.ChangeResourceRecordSets(context.TODO(), &route53.ChangeResourceRecordSetsInput{
+		ChangeBatch:  &types.ChangeBatch{Changes: changes, Comment: aws.String(changeComment())},
+		HostedZoneId: aws.String("/hostedzone/" + rec.HostedZoneId),
+	})
+	if err != nil {
+		return err
+	}
+	var old map[string][]string
+	if current != nil {
+		old = map[string][]string{
+			auditKey(aws.ToString(current.Name), current.Type, aws.ToString(current.SetIdentifier)): provider.Values(current),
+		}
+	}
+	auditChanges(rec.HostedZoneId, aws.ToString(output.ChangeInfo.Id), changes, old)
+
+	// The value of this instance was removed on purpose, which is not a drift
+	stateFor(rec).OwnValue = ""
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// slackNotifier posts events to a Slack incoming webhook.
+type slackNotifier struct {
+	url      string
+	channel  string
+	username string
+	client   *http.Client
+}
+
+func newSlackNotifier(url, channel, username string) *slackNotifier {
+	return &slackNotifier{
+		url:      url,
+		channel:  channel,
+		username: username,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (n *slackNotifier) name() string {
+	return "slack"
+}
+
+func (n *slackNotifier) notify(ev event) error {
+	var text string
+	switch ev.Type {
+	case eventChange:
+		text = fmt.Sprintf(":globe_with_meridians: *%s* changed: `%s` → `%s` (propagated in %.0fs)",
+			ev.Record, valueOrNone(ev.OldAddress), ev.NewAddress, ev.PropagationSeconds)
+	case eventFailure:
+		text = fmt.Sprintf(":warning: *%s* update failing: %s", ev.Record, ev.Error)
+	case eventRecovery:
+		text = fmt.Sprintf(":white_check_mark: *%s* recovered, updates are succeeding again", ev.Record)
+	case eventDrift:
+		text = fmt.Sprintf(":warning: *%s* changed by someone else: `%s` → `%s`",
+			ev.Record, ev.OldAddress, valueOrNone(ev.NewAddress))
+	case eventBudget:
+		text = fmt.Sprintf(":warning: Route53 API budget exceeded: %s", ev.Error)
+	case eventDNSSEC:
+		text = fmt.Sprintf(":closed_lock_with_key: *%s* DNSSEC validation failed: %s", ev.Record, ev.Error)
+	default:
+		return nil
+	}
+	if hasMessageTemplate(ev) {
+		text = eventMessage(ev)
+	}
+
+	payload := map[string]string{"text": text}
+	if n.channel != "" {
+		payload["channel"] = n.channel
+	}
+	if n.username != "" {
+		payload["username"] = n.username
+	}
+	return postJSON(n.client, n.url, payload)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+)
+
+// snsNotifier publishes events to an SNS topic. Email and SMS subscribers
+// receive a short text message, while other protocols (SQS, Lambda, HTTP)
+// receive the JSON encoded event.
+type snsNotifier struct {
+	svc      *sns.Client
+	topicArn string
+}
+
+func (n *snsNotifier) name() string {
+	return "sns"
+}
+
+func (n *snsNotifier) notify(ev event) error {
+	title := eventTitle(ev)
+	if title == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	text := fmt.Sprintf("%s: %s", title, eventMessage(ev))
+	message, err := json.Marshal(map[string]string{
+		"default": string(data),
+		"email":   text,
+		"sms":     text,
+	})
+	if err != nil {
+		return err
+	}
+
+	// SNS subjects are limited to 100 characters
+	subject := "[update-route53] " + title
+	if len(subject) > 100 {
+		subject = subject[:100]
+	}
+
+	_, err = n.svc.Publish(context.TODO(), &sns.PublishInput{
+		TopicArn:         aws.String(n.topicArn),
+		Subject:          aws.String(subject),
+		Message:          aws.String(string(message)),
+		MessageStructure: aws.String("json"),
+		MessageAttributes: map[string]snstypes.MessageAttributeValue{
+			"type": {DataType: aws.String("String"), StringValue: aws.String(ev.Type)},
+		},
+	})
+	return err
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"flouret.io/update-route53/pkg/provider"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+// Last known value of the SRV record and when it was read from Route53
+var (
+	srvRecordValue    string
+	srvRecordVerified time.Time
+)
+
+// srvValue returns the value the SRV record should have. The port is read
+// from SRV_PORT_FILE, if set, so it can follow dynamic port mappings.
+func srvValue() (string, error) {
+	port := srvPort
+	if srvPortFile != "" {
+		data, err := os.ReadFile(srvPortFile)
+		if err != nil {
+			return "", err
+		}
+		port, err = strconv.ParseUint(strings.TrimSpace(string(data)), 10, 16)
+		if err != nil || port == 0 {
+			return "", fmt.Errorf("invalid port in %s", srvPortFile)
+		}
+	}
+	return fmt.Sprintf("%d %d %d %s", srvPriority, srvWeight, port, srvTarget), nil
+}
+
+// getSRVRecordValue returns the value of the SRV record, or an empty string
+// if it does not exist.
+func getSRVRecordValue(svc *route53.Client) (string, error) {
+	recordSet, err := provider.New(svc).RecordSet(context.TODO(), hostedZoneId, srvRecord, types.RRTypeSrv, "")
+	if err != nil || recordSet == nil || len(recordSet.ResourceRecords) == 0 {
+		return "", err
+	}
+	return aws.ToString(recordSet.ResourceRecords[0].Value), nil
+}
+
+// updateSRVRecord sets the SRV record to its configured value, if it
+// changed. It does not wait for the change to propagate.
+func updateSRVRecord(svc *route53.Client) error {
+	logger := logger.With().Str("srvRecord", srvRecord).Logger()
+
+	value, err := srvValue()
+	if err != nil {
+		logger.Err(err).Msg("unable to get SRV record value")
+		return err
+	}
+
+	if srvRecordValue == "" || time.Since(srvRecordVerified) >= verifyInterval && !overBudget() {
+		srvRecordValue, err = getSRVRecordValue(svc)
+		if err != nil {
+			logger.Err(err).Msg("unable to get current SRV record value")
+			return fmt.Errorf("unable to get current SRV record value: %w", err)
+		}
+		srvRecordVerified = time.Now()
+	}
+	if srvRecordValue == value {
+		logger.Debug().Msg("SRV record has not changed")
+		return nil
+	}
+
+	changes := []types.Change{{
+		Action: types.ChangeActionUpsert,
+		ResourceRecordSet: &types.ResourceRecordSet{
+			Name:            aws.String(srvRecord),
+			Type:            types.RRTypeSrv,
+			TTL:             aws.Int64(int64(dnsTTL)),
+			ResourceRecords: []types.ResourceRecord{{Value: aws.String(value)}},
+		},
+	}}
+	changeId, err := newProvider(svc).Change(context.TODO(), hostedZoneId, changes)
+	if err != nil {
+		logger.Err(err).Msg("unable to change SRV record")
+		return fmt.Errorf("unable to change SRV record: %w", err)
+	}
+	var old map[string][]string
+	if srvRecordValue != "" {
+		old = map[string][]string{auditKey(srvRecord, types.RRTypeSrv, ""): {srvRecordValue}}
+	}
+	auditChanges(hostedZoneId, changeId, changes, old)
+
+	logger.Info().
+		Str("oldValue", srvRecordValue).
+		Str("newValue", value).
+		Msg("SRV record updated")
+	srvRecordValue = value
+	srvRecordVerified = time.Now()
+	return nil
+}
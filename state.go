@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"flouret.io/update-route53/pkg/updater"
+)
+
+// recordState is what is known about a managed record.
+type recordState = updater.State
+
+// state is the state of all managed records, keyed by record.Key(). It is
+// persisted to STATE_FILE, if set, so it survives restarts.
+var state = map[string]*recordState{}
+
+// stateFor returns the state of the given record, creating it if needed.
+func stateFor(rec record) *recordState {
+	s := state[rec.Key()]
+	if s == nil {
+		s = &recordState{}
+		state[rec.Key()] = s
+	}
+	return s
+}
+
+// loadState reads the state from the given file. A missing file is not an
+// error.
+func loadState(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &state)
+}
+
+// saveState atomically writes the state to the given file.
+func saveState(path string) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
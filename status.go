@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"flouret.io/update-route53/pkg/provider"
+)
+
+// maxRecentErrors is the number of errors kept for the status endpoint.
+const maxRecentErrors = 10
+
+// instanceStatus is served by the /status endpoint.
+type instanceStatus struct {
+	Version      string         `json:"version"`
+	LastCycle    time.Time      `json:"lastCycle,omitempty"`
+	Records      []recordStatus `json:"records"`
+	RecentErrors []statusError  `json:"recentErrors,omitempty"`
+}
+
+// recordStatus is the status of a managed record.
+type recordStatus struct {
+	Name                string    `json:"name"`
+	HostedZoneId        string    `json:"hostedZoneId"`
+	Address             string    `json:"address,omitempty"`
+	RecordValues        []string  `json:"recordValues,omitempty"`
+	TTL                 uint64    `json:"ttl,omitempty"`
+	LastChange          time.Time `json:"lastChange,omitempty"`
+	ConsecutiveFailures uint64    `json:"consecutiveFailures,omitempty"`
+}
+
+// statusError is an update error of a record.
+type statusError struct {
+	Time   time.Time `json:"time"`
+	Cycle  string    `json:"cycle,omitempty"`
+	Record string    `json:"record"`
+	Class  string    `json:"class"`
+	Error  string    `json:"error"`
+}
+
+var (
+	statusMu     sync.Mutex
+	lastStatus   = instanceStatus{Records: []recordStatus{}}
+	recentErrors []statusError // Most recent last
+)
+
+// addRecentError keeps the error of a record for the status endpoint.
+func addRecentError(rec record, err error) {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+
+	recentErrors = append(recentErrors, statusError{
+		Time:   time.Now().UTC(),
+		Cycle:  currentCycle(),
+		Record: rec.Name,
+		Class:  errorClass(err),
+		Error:  err.Error(),
+	})
+	if len(recentErrors) > maxRecentErrors {
+		recentErrors = recentErrors[len(recentErrors)-maxRecentErrors:]
+	}
+}
+
+// publishStatus takes a snapshot of the state of the records after an
+// update cycle. It must be called while cycleMu is held.
+func publishStatus(records []record) {
+	status := instanceStatus{
+		Version:   buildVersion(),
+		LastCycle: time.Now().UTC(),
+		Records:   make([]recordStatus, 0, len(records)),
+	}
+	for _, rec := range records {
+		st := stateFor(rec)
+		status.Records = append(status.Records, recordStatus{
+			Name:                rec.Name,
+			HostedZoneId:        rec.HostedZoneId,
+			Address:             st.LastAddress,
+			RecordValues:        append([]string(nil), st.RecordValues...),
+			TTL:                 st.RecordTTL,
+			LastChange:          st.LastChange,
+			ConsecutiveFailures: consecutiveFailures[rec.Key()],
+		})
+	}
+
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	status.RecentErrors = append([]statusError(nil), recentErrors...)
+	lastStatus = status
+}
+
+// handleStatus serves the status of the last update cycle as JSON.
+func handleStatus(w http.ResponseWriter, r *http.Request) {
+	statusMu.Lock()
+	data, err := json.Marshal(lastStatus)
+	statusMu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// serveAdminSocket serves the health check, metrics and status endpoints on
+// a unix socket, replacing a stale socket file.
+func serveAdminSocket(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	return http.Serve(listener, nil)
+}
+
+// runStatus queries the /status endpoint of a locally running instance,
+// through the admin socket if set, and prints it. It returns the process
+// exit code.
+func runStatus(port uint64, socket string) int {
+	client := &http.Client{Timeout: 5 * time.Second}
+	url := fmt.Sprintf("http://127.0.0.1:%d/status", port)
+	if socket != "" {
+		client.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		}
+		url = "http://update-route53/status"
+	}
+
+	resp, err := client.Get(url)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to get status: %v\n", err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "unable to get status: %s\n", resp.Status)
+		return 1
+	}
+
+	var status instanceStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		fmt.Fprintf(os.Stderr, "unable to decode status: %v\n", err)
+		return 1
+	}
+	printStatus(os.Stdout, status)
+	return 0
+}
+
+// printStatus writes the status in a human readable form.
+func printStatus(w io.Writer, status instanceStatus) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	defer tw.Flush()
+
+	fmt.Fprintf(tw, "Version:\t%s\n", status.Version)
+	if status.LastCycle.IsZero() {
+		fmt.Fprintf(tw, "Last cycle:\tnever\n")
+	} else {
+		fmt.Fprintf(tw, "Last cycle:\t%s\n", formatStatusTime(status.LastCycle))
+	}
+
+	for _, rec := range status.Records {
+		fmt.Fprintf(tw, "\n%s (%s)\n", provider.DisplayName(rec.Name), rec.HostedZoneId)
+		fmt.Fprintf(tw, "  Address:\t%s\n", orNone(rec.Address))
+		fmt.Fprintf(tw, "  Record:\t%s", orNone(strings.Join(rec.RecordValues, ", ")))
+		if rec.TTL > 0 {
+			fmt.Fprintf(tw, " (TTL %d)", rec.TTL)
+		}
+		fmt.Fprintln(tw)
+		if rec.LastChange.IsZero() {
+			fmt.Fprintf(tw, "  Last change:\tnever\n")
+		} else {
+			fmt.Fprintf(tw, "  Last change:\t%s\n", formatStatusTime(rec.LastChange))
+		}
+		if rec.ConsecutiveFailures > 0 {
+			fmt.Fprintf(tw, "  Failures:\t%d in a row\n", rec.ConsecutiveFailures)
+		}
+	}
+
+	if len(status.RecentErrors) > 0 {
+		fmt.Fprintf(tw, "\nRecent errors:\n")
+		for _, e := range status.RecentErrors {
+			fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%s\n", e.Time.Local().Format(time.DateTime), e.Cycle, provider.DisplayName(e.Record), e.Class, e.Error)
+		}
+	}
+}
+
+// formatStatusTime formats t in local time along with how long ago it was.
+func formatStatusTime(t time.Time) string {
+	return fmt.Sprintf("%s (%s ago)", t.Local().Format(time.DateTime), time.Since(t).Round(time.Second))
+}
+
+// orNone returns s, or "none" if it is empty.
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
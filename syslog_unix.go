@@ -0,0 +1,68 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"bytes"
+	"log/syslog"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// syslogWriter sends log events to the local syslog daemon, in the given log
+// format, with the priority of their level.
+type syslogWriter struct {
+	w      *syslog.Writer
+	format string
+}
+
+// newSyslogWriter connects to the local syslog daemon.
+func newSyslogWriter(format string) (*syslogWriter, error) {
+	if _, err := logWriter(format, nil); err != nil {
+		return nil, err
+	}
+	w, err := syslog.New(syslog.LOG_INFO|syslog.LOG_DAEMON, syslogIdentifier)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogWriter{w: w, format: format}, nil
+}
+
+func (s *syslogWriter) Write(p []byte) (int, error) {
+	return s.WriteLevel(zerolog.NoLevel, p)
+}
+
+func (s *syslogWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	// Format the event, without colors which syslog would not render
+	var buf bytes.Buffer
+	formatter, _ := logWriter(s.format, &buf)
+	if console, ok := formatter.(zerolog.ConsoleWriter); ok {
+		console.NoColor = true
+		formatter = console
+	}
+	if _, err := formatter.Write(p); err != nil {
+		return 0, err
+	}
+	msg := strings.TrimRight(buf.String(), "\n")
+
+	var err error
+	switch level {
+	case zerolog.TraceLevel, zerolog.DebugLevel:
+		err = s.w.Debug(msg)
+	case zerolog.WarnLevel:
+		err = s.w.Warning(msg)
+	case zerolog.ErrorLevel:
+		err = s.w.Err(msg)
+	case zerolog.FatalLevel:
+		err = s.w.Crit(msg)
+	case zerolog.PanicLevel:
+		err = s.w.Emerg(msg)
+	default:
+		err = s.w.Info(msg)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// sdNotify sends a state notification to the systemd service manager. It is a
+// no-op when the process is not running under systemd (NOTIFY_SOCKET unset).
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+
+	// Abstract namespace sockets are reported with a leading '@'
+	addr := &net.UnixAddr{Name: socket, Net: "unixgram"}
+	if socket[0] == '@' {
+		addr.Name = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// sdWatchdogInterval returns the interval at which the watchdog should be
+// pinged, or zero if the systemd watchdog is not enabled for this process.
+func sdWatchdogInterval() time.Duration {
+	usecStr := os.Getenv("WATCHDOG_USEC")
+	if usecStr == "" {
+		return 0
+	}
+
+	// WATCHDOG_PID, if set, must match our pid
+	if pidStr := os.Getenv("WATCHDOG_PID"); pidStr != "" {
+		pid, err := strconv.Atoi(pidStr)
+		if err != nil || pid != os.Getpid() {
+			return 0
+		}
+	}
+
+	usec, err := strconv.ParseUint(usecStr, 10, 64)
+	if err != nil || usec == 0 {
+		return 0
+	}
+
+	// Ping at half the timeout, as recommended by sd_watchdog_enabled(3)
+	return time.Duration(usec) * time.Microsecond / 2
+}
+
+// sleepWithWatchdog sleeps for the given duration, or until an update is
+// triggered, while keeping the systemd watchdog fed. The watchdog is only
+// pinged from the main loop so a wedged update cycle still causes systemd to
+// restart the service. It returns true if an update was triggered.
+func sleepWithWatchdog(d time.Duration, interval time.Duration) bool {
+	if interval <= 0 {
+		select {
+		case <-time.After(d):
+			return false
+		case <-triggerCh:
+			return true
+		}
+	}
+
+	deadline := time.Now().Add(d)
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return false
+		}
+		select {
+		case <-time.After(min(remaining, interval)):
+		case <-triggerCh:
+			return true
+		}
+		sdNotify("WATCHDOG=1")
+	}
+}
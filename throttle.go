@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Scopes of throttling backoffs, in the update_route53_throttle_backoffs_total
+// metric: a throttled AWS API call retried by the SDK, or the update cycles
+// skipped after a throttled cycle.
+const (
+	throttleScopeCall  = "call"
+	throttleScopeCycle = "cycle"
+)
+
+var (
+	throttleBackoffs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "update_route53_throttle_backoffs_total",
+		Help: "Backoffs after AWS throttling, by scope",
+	}, []string{"scope"})
+	throttleBackoffSeconds = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "update_route53_throttle_backoff_seconds_total",
+		Help: "Time spent backing off after AWS throttling, by scope",
+	}, []string{"scope"})
+)
+
+func init() {
+	prometheus.MustRegister(throttleBackoffs)
+	prometheus.MustRegister(throttleBackoffSeconds)
+}
+
+// cycleThrottle tracks the backoff of update cycles after throttled cycles.
+var cycleThrottle struct {
+	mu    sync.Mutex
+	count int       // Consecutive throttled cycles
+	until time.Time // End of the current backoff
+}
+
+// throttleDelay returns the backoff of the update cycles after the given
+// number of consecutive throttled cycles: exponential from THROTTLE_BACKOFF up
+// to THROTTLE_MAX_BACKOFF, with jitter. Route53 throttles changes per account,
+// so retrying as fast as other errors only prolongs the throttling.
+func throttleDelay(cycles int) time.Duration {
+	delay := throttleBackoff << (cycles - 1)
+	if delay > throttleMaxBackoff || delay <= 0 {
+		delay = throttleMaxBackoff
+	}
+	return equalJitter(delay)
+}
+
+// equalJitter returns half the delay, plus a random part of the other half.
+func equalJitter(delay time.Duration) time.Duration {
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// awsBackoff returns the backoff of retried AWS API calls: the standard
+// exponential backoff capped at RETRY_MAX_DELAY, except that throttled calls
+// wait the full RETRY_MAX_DELAY (with jitter) from the first retry. Longer
+// waits are left to the backoff of the update cycles, since the cycle holds
+// the record locks and the systemd watchdog is not notified during a call.
+func awsBackoff() retry.BackoffDelayer {
+	standard := retry.NewExponentialJitterBackoff(retryMaxDelay)
+	return retry.BackoffDelayerFunc(func(attempt int, err error) (time.Duration, error) {
+		if !errors.Is(classifyError(err), errThrottled) {
+			return standard.BackoffDelay(attempt, err)
+		}
+		delay := equalJitter(retryMaxDelay)
+		throttleBackoffs.WithLabelValues(throttleScopeCall).Inc()
+		throttleBackoffSeconds.WithLabelValues(throttleScopeCall).Add(delay.Seconds())
+		logger.Warn().
+			Err(err).
+			Int("attempt", attempt).
+			Str("delay", delay.String()).
+			Msg("throttled by aws, backing off")
+		return delay, nil
+	})
+}
+
+// throttledCycle returns an error wrapping errThrottled while the update
+// cycles back off after a throttled cycle, in which case the cycle is
+// skipped.
+func throttledCycle() error {
+	cycleThrottle.mu.Lock()
+	defer cycleThrottle.mu.Unlock()
+	if !time.Now().Before(cycleThrottle.until) {
+		return nil
+	}
+	logger.Warn().
+		Time("until", cycleThrottle.until).
+		Msg("throttled by aws, skipping update")
+	return fmt.Errorf("%w: backing off until %s", errThrottled, cycleThrottle.until.Format(time.RFC3339))
+}
+
+// recordThrottle starts a backoff of the update cycles when a cycle ended
+// throttled, doubling from THROTTLE_BACKOFF with each consecutive throttled
+// cycle up to THROTTLE_MAX_BACKOFF, and resets it when a cycle was not
+// throttled.
+func recordThrottle(throttled bool) {
+	cycleThrottle.mu.Lock()
+	defer cycleThrottle.mu.Unlock()
+	if !throttled {
+		cycleThrottle.count = 0
+		return
+	}
+	cycleThrottle.count++
+	delay := throttleDelay(cycleThrottle.count)
+	cycleThrottle.until = time.Now().Add(delay)
+	throttleBackoffs.WithLabelValues(throttleScopeCycle).Inc()
+	throttleBackoffSeconds.WithLabelValues(throttleScopeCycle).Add(delay.Seconds())
+	logger.Warn().
+		Int("throttledCycles", cycleThrottle.count).
+		Str("delay", delay.String()).
+		Msg("throttled by aws, backing off updates")
+}
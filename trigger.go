@@ -0,0 +1,13 @@
+package main
+
+// triggerCh wakes up the main loop to run an update cycle immediately.
+var triggerCh = make(chan struct{}, 1)
+
+// triggerUpdate requests an immediate update cycle. Requests made while one
+// is already pending are coalesced.
+func triggerUpdate() {
+	select {
+	case triggerCh <- struct{}{}:
+	default:
+	}
+}
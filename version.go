@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+)
+
+// Build information, injected at build time with
+// -ldflags "-X main.version=1.2.3 -X main.commit=... -X main.buildDate=..."
+var (
+	version   = ""
+	commit    = ""
+	buildDate = ""
+)
+
+// buildCommit returns the git commit of the binary, injected at build time or
+// from the build info embedded by the go toolchain.
+func buildCommit() string {
+	if commit != "" {
+		return commit
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" && len(setting.Value) >= 12 {
+			return setting.Value[:12]
+		}
+	}
+	return ""
+}
+
+// buildVersion returns the version of the binary: the version injected at
+// build time, or else the git commit or module version.
+func buildVersion() string {
+	if version != "" {
+		return version
+	}
+	if commit := buildCommit(); commit != "" {
+		return commit
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	return info.Main.Version
+}
+
+// printVersion writes the version, git commit, go version and build date of
+// the binary.
+func printVersion(w io.Writer) {
+	fmt.Fprintf(w, "update-route53 %s\n", buildVersion())
+	if commit := buildCommit(); commit != "" {
+		fmt.Fprintf(w, "commit: %s\n", commit)
+	}
+	if buildDate != "" {
+		fmt.Fprintf(w, "built: %s\n", buildDate)
+	}
+	fmt.Fprintf(w, "go: %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"text/template"
+	"time"
+)
+
+// webhookTimeout caps the time spent delivering an event, retries included,
+// since events are sent from the update cycle.
+const webhookTimeout = 15 * time.Second
+
+// webhookNotifier posts events to an HTTP endpoint. The body is the JSON
+// encoded event unless a template is configured. When a secret is set, the
+// body is signed with HMAC-SHA256 in the X-Signature-256 header.
+type webhookNotifier struct {
+	url      string
+	template *template.Template
+	secret   string
+	retries  int
+	client   *http.Client
+}
+
+func newWebhookNotifier(url, bodyTemplate, secret string, retries int) (*webhookNotifier, error) {
+	n := &webhookNotifier{
+		url:     url,
+		secret:  secret,
+		retries: retries,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+	if bodyTemplate != "" {
+		tmpl, err := template.New("webhook").Funcs(templateFuncs).Parse(bodyTemplate)
+		if err != nil {
+			return nil, err
+		}
+		n.template = tmpl
+	}
+	return n, nil
+}
+
+func (n *webhookNotifier) name() string {
+	return "webhook"
+}
+
+func (n *webhookNotifier) notify(ev event) error {
+	var body []byte
+	if n.template != nil {
+		var buf bytes.Buffer
+		if err := n.template.Execute(&buf, ev); err != nil {
+			return fmt.Errorf("unable to render webhook template: %w", err)
+		}
+		body = buf.Bytes()
+	} else {
+		var err error
+		if body, err = json.Marshal(ev); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+
+	var err error
+	for attempt := 0; attempt <= n.retries; attempt++ {
+		if attempt > 0 {
+			delay := time.Duration(attempt) * 2 * time.Second
+			if time.Until(deadline) < delay {
+				return fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+			}
+			time.Sleep(delay)
+		}
+		if err = n.post(ctx, body); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (n *webhookNotifier) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "update-route53")
+	if n.secret != "" {
+		mac := hmac.New(sha256.New, []byte(n.secret))
+		mac.Write(body)
+		req.Header.Set("X-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"flouret.io/update-route53/pkg/provider"
+)
+
+// wireGuardPeer is a WireGuard peer whose endpoint is one of the records.
+type wireGuardPeer struct {
+	iface     string // Local WireGuard interface
+	publicKey string // Base64 public key of the peer
+	host      string // Name of the record the endpoint points at
+	port      string // Port of the endpoint
+}
+
+// wireGuardPeers lists the peers refreshed after changes (WIREGUARD_PEERS)
+var wireGuardPeers []wireGuardPeer
+
+// wireGuardSocketDir is where userspace WireGuard implementations, such as
+// wireguard-go and boringtun, listen for configuration requests.
+const wireGuardSocketDir = "/var/run/wireguard"
+
+// parseWireGuardPeers parses a comma separated list of
+// "<interface>:<public key>@<host>:<port>" peers.
+func parseWireGuardPeers(s string) ([]wireGuardPeer, error) {
+	var peers []wireGuardPeer
+	for _, spec := range strings.Split(s, ",") {
+		spec = strings.TrimSpace(spec)
+		iface, rest, ok1 := strings.Cut(spec, ":")
+		publicKey, endpoint, ok2 := strings.Cut(rest, "@")
+		host, port, err := net.SplitHostPort(endpoint)
+		if !ok1 || !ok2 || iface == "" || err != nil {
+			return nil, fmt.Errorf("invalid peer %q, expected <interface>:<public key>@<host>:<port>", spec)
+		}
+		if key, err := base64.StdEncoding.DecodeString(publicKey); err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("invalid public key of peer %q", spec)
+		}
+		if n, err := strconv.ParseUint(port, 10, 16); err != nil || n == 0 {
+			return nil, fmt.Errorf("invalid port of peer %q", spec)
+		}
+		host, err = provider.NormalizeName(host)
+		if err != nil {
+			return nil, fmt.Errorf("invalid host of peer %q: %w", spec, err)
+		}
+		peers = append(peers, wireGuardPeer{iface, publicKey, host, port})
+	}
+	return peers, nil
+}
+
+// refreshWireGuardPeers points the endpoint of the WireGuard peers at the
+// given record to its new address. WireGuard only resolves the host of an
+// endpoint when it is configured, so the peers would otherwise keep using the
+// old address.
+func refreshWireGuardPeers(rec record, address string) {
+	for _, peer := range wireGuardPeers {
+		if !provider.SameName(rec.Name, peer.host) {
+			continue
+		}
+		endpoint := net.JoinHostPort(address, peer.port)
+		logger := logger.With().
+			Str("interface", peer.iface).
+			Str("peer", peer.publicKey).
+			Str("endpoint", endpoint).
+			Logger()
+		if err := setWireGuardEndpoint(peer, endpoint); err != nil {
+			logger.Err(err).Msg("unable to refresh wireguard peer")
+			continue
+		}
+		logger.Info().Msg("wireguard peer refreshed")
+	}
+}
+
+// setWireGuardEndpoint sets the endpoint of a peer, through the configuration
+// socket of the interface if it is a userspace implementation, and with the
+// wg command otherwise.
+func setWireGuardEndpoint(peer wireGuardPeer, endpoint string) error {
+	socket := filepath.Join(wireGuardSocketDir, peer.iface+".sock")
+	if _, err := os.Stat(socket); err == nil {
+		return setWireGuardEndpointUAPI(socket, peer, endpoint)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, "wg", "set", peer.iface, "peer", peer.publicKey, "endpoint", endpoint).CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(output)); msg != "" {
+			return fmt.Errorf("wg set failed: %w: %s", err, msg)
+		}
+		return fmt.Errorf("wg set failed: %w", err)
+	}
+	return nil
+}
+
+// setWireGuardEndpointUAPI sets the endpoint of a peer with the cross-platform
+// userspace configuration protocol of WireGuard.
+func setWireGuardEndpointUAPI(socket string, peer wireGuardPeer, endpoint string) error {
+	conn, err := net.DialTimeout("unix", socket, 10*time.Second)
+	if err != nil {
+		return fmt.Errorf("unable to connect to %s: %w", socket, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(hookTimeout))
+
+	// The protocol uses hex encoded keys. update_only leaves the other peers
+	// untouched, and does not add the peer if it is not configured.
+	key, _ := base64.StdEncoding.DecodeString(peer.publicKey)
+	request := fmt.Sprintf("set=1\npublic_key=%s\nupdate_only=true\nendpoint=%s\n\n", hex.EncodeToString(key), endpoint)
+	if _, err := conn.Write([]byte(request)); err != nil {
+		return fmt.Errorf("unable to send configuration: %w", err)
+	}
+
+	// The response is "errno=<n>", followed by an empty line
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		if errno, ok := strings.CutPrefix(scanner.Text(), "errno="); ok {
+			if errno != "0" {
+				return fmt.Errorf("configuration failed with errno %s", errno)
+			}
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("unable to read configuration response: %w", err)
+	}
+	return errors.New("no configuration response")
+}